@@ -4,19 +4,143 @@ import (
 	"net/url"
 )
 
-// Verify the credentials by making a very small request
+// InvalidTokenError is returned by VerifyCredentials for an access token which was revoked or never existed (code 89)
+type InvalidTokenError struct {
+	*ApiError
+}
+
+func (e InvalidTokenError) Unwrap() error {
+	return e.ApiError
+}
+
+// AccountSuspendedError is returned by VerifyCredentials for the token of a suspended account (code 64)
+type AccountSuspendedError struct {
+	*ApiError
+}
+
+func (e AccountSuspendedError) Unwrap() error {
+	return e.ApiError
+}
+
+// BadAuthenticationDataError is returned by VerifyCredentials for a request whose OAuth data is missing or malformed (code 215)
+type BadAuthenticationDataError struct {
+	*ApiError
+}
+
+func (e BadAuthenticationDataError) Unwrap() error {
+	return e.ApiError
+}
+
+// AccountSettings are the settings of the authenticated user
+// https://developer.twitter.com/en/docs/accounts-and-users/manage-account-settings/api-reference/get-account-settings
+type AccountSettings struct {
+	AllowContributorRequest   string `json:"allow_contributor_request"`
+	AllowDmGroupsFrom         string `json:"allow_dm_groups_from"`
+	AllowDmsFrom              string `json:"allow_dms_from"`
+	AlwaysUseHttps            bool   `json:"always_use_https"`
+	DiscoverableByEmail       bool   `json:"discoverable_by_email"`
+	DiscoverableByMobilePhone bool   `json:"discoverable_by_mobile_phone"`
+	DisplaySensitiveMedia     bool   `json:"display_sensitive_media"`
+	GeoEnabled                bool   `json:"geo_enabled"`
+	Language                  string `json:"language"`
+	Protected                 bool   `json:"protected"`
+	ScreenName                string `json:"screen_name"`
+	SleepTime                 struct {
+		Enabled bool `json:"enabled"`
+		// Hours of the day in the time zone of the user, nil when disabled
+		StartTime *int `json:"start_time"`
+		EndTime   *int `json:"end_time"`
+	} `json:"sleep_time"`
+	TimeZone struct {
+		Name       string `json:"name"`
+		TzinfoName string `json:"tzinfo_name"`
+		UtcOffset  int    `json:"utc_offset"`
+	} `json:"time_zone"`
+	TranslatorType           string          `json:"translator_type"`
+	TrendLocation            []TrendLocation `json:"trend_location"`
+	UseCookiePersonalization bool            `json:"use_cookie_personalization"`
+}
+
+// Verify the credentials by making a very small request.
+// Rejected credentials are reported as an InvalidTokenError, an AccountSuspendedError
+// or a BadAuthenticationDataError, the other failures as the error of the request.
 func (a TwitterApi) VerifyCredentials() (ok bool, err error) {
 	v := cleanValues(nil)
 	v.Set("include_entities", "false")
 	v.Set("skip_status", "true")
 
 	_, err = a.GetSelf(v)
-	return err == nil, err
+	return err == nil, credentialsError(err)
+}
+
+// credentialsError types the ApiErrors of rejected credentials
+func credentialsError(err error) error {
+	apiErr, ok := err.(*ApiError)
+	if !ok {
+		return err
+	}
+	for _, e := range apiErr.Decoded.Errors {
+		switch e.Code {
+		case TwitterErrorInvalidToken:
+			return InvalidTokenError{apiErr}
+		case TwitterErrorAccountSuspended:
+			return AccountSuspendedError{apiErr}
+		case TwitterErrorBadAuthenticationData:
+			return BadAuthenticationDataError{apiErr}
+		}
+	}
+	return err
 }
 
 // Get the user object for the authenticated user. Requests /account/verify_credentials
 func (a TwitterApi) GetSelf(v url.Values) (u User, err error) {
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/account/verify_credentials.json", v, &u, _GET, response_ch}
-	return u, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/account/verify_credentials.json", v, &u, _GET)
+	return u, err
+}
+
+// GetAccountSettings returns the settings of the authenticated user
+// https://developer.twitter.com/en/docs/accounts-and-users/manage-account-settings/api-reference/get-account-settings
+func (a TwitterApi) GetAccountSettings(v url.Values) (settings AccountSettings, err error) {
+	err = a.sendQuery(a.baseUrl+"/account/settings.json", v, &settings, _GET)
+	return settings, err
+}
+
+// UpdateAccountSettings updates the settings of the authenticated user set in v, such as lang, time_zone,
+// sleep_time_enabled, start_sleep_time, end_sleep_time or trend_location_woeid, and returns the new settings
+// https://developer.twitter.com/en/docs/accounts-and-users/manage-account-settings/api-reference/post-account-settings
+func (a TwitterApi) UpdateAccountSettings(v url.Values) (settings AccountSettings, err error) {
+	err = a.sendQuery(a.baseUrl+"/account/settings.json", v, &settings, _POST)
+	return settings, err
+}
+
+// UpdateProfile updates the fields of the profile of the authenticated user set in v:
+// name, url, location, description or profile_link_color
+// https://developer.twitter.com/en/docs/accounts-and-users/manage-account-settings/api-reference/post-account-update_profile
+func (a TwitterApi) UpdateProfile(v url.Values) (u User, err error) {
+	err = a.sendQuery(a.baseUrl+"/account/update_profile.json", v, &u, _POST)
+	return u, err
+}
+
+// UpdateProfileImage replaces the avatar of the authenticated user with image, a GIF, JPG or PNG of up to 700 kB
+// https://developer.twitter.com/en/docs/accounts-and-users/manage-account-settings/api-reference/post-account-update_profile_image
+func (a TwitterApi) UpdateProfileImage(image []byte, v url.Values) (u User, err error) {
+	err = a.sendMultipartQuery(a.baseUrl+"/account/update_profile_image.json", v, map[string][]byte{"image": image}, &u)
+	return u, err
+}
+
+// UpdateProfileBanner replaces the banner of the authenticated user with banner, cropped by
+// width, height, offset_left and offset_top in v when set.
+// Twitter may process the banner after UpdateProfileBanner returns.
+// https://developer.twitter.com/en/docs/accounts-and-users/manage-account-settings/api-reference/post-account-update_profile_banner
+func (a TwitterApi) UpdateProfileBanner(banner []byte, v url.Values) error {
+	return a.sendMultipartQuery(a.baseUrl+"/account/update_profile_banner.json", v, map[string][]byte{"banner": banner}, nil)
+}
+
+// InvalidateAccessToken revokes the access token of the client, which cannot be used anymore
+// https://developer.twitter.com/en/docs/basics/authentication/api-reference/invalidate_access_token
+func (a TwitterApi) InvalidateAccessToken() error {
+	var resp struct {
+		AccessToken string `json:"access_token"`
+	}
+	return a.sendQuery(a.baseUrl+"/oauth/invalidate_token", nil, &resp, _POST)
 }
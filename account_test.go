@@ -0,0 +1,122 @@
+package anaconda_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ChimeraCoder/anaconda"
+)
+
+func Test_TwitterApi_Account(t *testing.T) {
+	var invalidated bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/account/settings.json":
+			if r.Method == http.MethodPost {
+				r.ParseForm()
+				if r.PostForm.Get("lang") != "fr" {
+					t.Errorf("Unexpected form %v", r.PostForm)
+				}
+			}
+			w.Write([]byte(`{"language": "fr", "screen_name": "gopher", "sleep_time": {"enabled": true, "start_time": 23, "end_time": 7},
+				"time_zone": {"name": "Paris", "tzinfo_name": "Europe/Paris", "utc_offset": 3600},
+				"trend_location": [{"name": "France", "woeid": 23424819}]}`))
+		case "/account/update_profile_image.json", "/account/update_profile_banner.json":
+			field := "image"
+			if r.URL.Path == "/account/update_profile_banner.json" {
+				field = "banner"
+			}
+			file, _, err := r.FormFile(field)
+			if err != nil {
+				t.Errorf("Expected the %s file: %s", field, err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			content, _ := ioutil.ReadAll(file)
+			if string(content) != "picture" {
+				t.Errorf("Unexpected %s %q", field, content)
+			}
+			if field == "banner" {
+				if r.FormValue("width") != "1500" {
+					t.Errorf("Unexpected width %q", r.FormValue("width"))
+				}
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+			w.Write([]byte(`{"screen_name": "gopher"}`))
+		case "/oauth/invalidate_token":
+			invalidated = true
+			w.Write([]byte(`{"access_token": "token"}`))
+		default:
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+	}))
+	defer server.Close()
+
+	api := anaconda.NewTwitterApiWithCredentials("token", "secret", "consumer", "consumersecret")
+	api.SetBaseUrl(server.URL)
+	defer api.Close()
+
+	settings, err := api.GetAccountSettings(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.TimeZone.TzinfoName != "Europe/Paris" || settings.SleepTime.StartTime == nil || *settings.SleepTime.StartTime != 23 ||
+		len(settings.TrendLocation) != 1 || settings.TrendLocation[0].Woeid != 23424819 {
+		t.Errorf("Unexpected settings %+v", settings)
+	}
+	if settings, err = api.UpdateAccountSettings(url.Values{"lang": {"fr"}}); err != nil || settings.Language != "fr" {
+		t.Errorf("Unexpected settings %+v, %v", settings, err)
+	}
+
+	if u, err := api.UpdateProfileImage([]byte("picture"), nil); err != nil || u.ScreenName != "gopher" {
+		t.Errorf("Unexpected user %+v, %v", u, err)
+	}
+	if err := api.UpdateProfileBanner([]byte("picture"), url.Values{"width": {"1500"}}); err != nil {
+		t.Errorf("Expected a 201 to succeed, got %v", err)
+	}
+
+	if err := api.InvalidateAccessToken(); err != nil || !invalidated {
+		t.Errorf("Expected the token to be invalidated, got %v", err)
+	}
+}
+
+func Test_TwitterApi_VerifyCredentials(t *testing.T) {
+	for _, c := range []struct {
+		status int
+		body   string
+		check  func(error) bool
+	}{
+		{401, `{"errors": [{"code": 89, "message": "Invalid or expired token."}]}`, func(err error) bool {
+			var e anaconda.InvalidTokenError
+			return errors.As(err, &e)
+		}},
+		{403, `{"errors": [{"code": 64, "message": "Your account is suspended and is not permitted to access this feature"}]}`, func(err error) bool {
+			var e anaconda.AccountSuspendedError
+			return errors.As(err, &e)
+		}},
+		{400, `{"errors": [{"code": 215, "message": "Bad Authentication data."}]}`, func(err error) bool {
+			var e anaconda.BadAuthenticationDataError
+			var apiErr *anaconda.ApiError
+			return errors.As(err, &e) && errors.As(err, &apiErr) && apiErr.StatusCode == 400
+		}},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(c.status)
+			w.Write([]byte(c.body))
+		}))
+		api := anaconda.NewTwitterApiWithCredentials("token", "secret", "consumer", "consumersecret")
+		api.SetBaseUrl(server.URL)
+
+		ok, err := api.VerifyCredentials()
+		if ok || !c.check(err) {
+			t.Errorf("Unexpected error %#v for status %d", err, c.status)
+		}
+		api.Close()
+		server.Close()
+	}
+}
@@ -0,0 +1,139 @@
+package anaconda
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// ErrNoConsumerCredentials is returned when a bearer token must be requested or invalidated
+// by a client created without the consumer key and secret of the app
+var ErrNoConsumerCredentials = errors.New("anaconda: the consumer key and secret are needed to request or invalidate a bearer token")
+
+// bearerAuth holds the bearer token of an application-only client, shared by the copies of the client
+type bearerAuth struct {
+	consumerKey    string
+	consumerSecret string
+
+	mu    sync.Mutex
+	token string
+}
+
+//NewTwitterApiAppOnly takes an app-specific consumer key and secret and returns a TwitterApi struct
+//authenticated as the app itself rather than as a user, with application-only OAuth 2.
+//The bearer token is requested from oauth2/token by the first query, then cached.
+//Endpoints which need a user context, such as statuses/update or the user streams, are rejected by Twitter.
+//https://developer.twitter.com/en/docs/basics/authentication/overview/application-only
+func NewTwitterApiAppOnly(consumer_key string, consumer_secret string) *TwitterApi {
+	return NewTwitterApiWithOptions(WithAppOnlyCredentials(consumer_key, consumer_secret))
+}
+
+//NewTwitterApiWithBearerToken returns a TwitterApi struct authenticated as an app with an existing bearer token.
+//Without the consumer key and secret, the token cannot be requested again nor invalidated.
+func NewTwitterApiWithBearerToken(token string) *TwitterApi {
+	return NewTwitterApiWithOptions(WithBearerToken(token))
+}
+
+// BearerToken returns the bearer token of an application-only client, requesting it if it is not cached yet.
+// https://developer.twitter.com/en/docs/basics/authentication/api-reference/token
+func (a TwitterApi) BearerToken() (string, error) {
+	if a.bearer == nil {
+		return "", errors.New("anaconda: not an application-only client")
+	}
+	return a.bearerToken(a.Context())
+}
+
+// InvalidateBearerToken revokes the bearer token of an application-only client.
+// The next query requests a new token.
+// https://developer.twitter.com/en/docs/basics/authentication/api-reference/invalidate_bearer_token
+func (a TwitterApi) InvalidateBearerToken() error {
+	if a.bearer == nil {
+		return errors.New("anaconda: not an application-only client")
+	}
+	b := a.bearer
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.token == "" {
+		return nil
+	}
+
+	v := url.Values{}
+	v.Set("access_token", b.token)
+	var resp struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := a.consumerPost(a.Context(), "/oauth2/invalidate_token", v, &resp); err != nil {
+		return err
+	}
+	b.token = ""
+	return nil
+}
+
+// bearerToken returns the cached token, or requests one
+func (a TwitterApi) bearerToken(ctx context.Context) (string, error) {
+	b := a.bearer
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.token != "" {
+		return b.token, nil
+	}
+
+	v := url.Values{}
+	v.Set("grant_type", "client_credentials")
+	var resp struct {
+		TokenType   string `json:"token_type"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := a.consumerPost(ctx, "/oauth2/token", v, &resp); err != nil {
+		return "", err
+	}
+	if resp.TokenType != "bearer" || resp.AccessToken == "" {
+		return "", fmt.Errorf("anaconda: unexpected token of type %q from oauth2/token", resp.TokenType)
+	}
+	b.token = resp.AccessToken
+	return b.token, nil
+}
+
+// forgetBearerToken drops token from the cache when Twitter rejected it, so that the next query requests a new one
+func (a TwitterApi) forgetBearerToken(token string) {
+	b := a.bearer
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.token == token && b.consumerKey != "" {
+		b.token = ""
+	}
+}
+
+// consumerPost sends form to an oauth2 endpoint, authenticated with the consumer key and secret,
+// and decodes the response JSON to data. It bypasses the query queue, as it runs while signing a query.
+func (a TwitterApi) consumerPost(ctx context.Context, path string, form url.Values, data interface{}) error {
+	b := a.bearer
+	if b.consumerKey == "" || b.consumerSecret == "" {
+		return ErrNoConsumerCredentials
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.oauthBaseUrl()+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(url.QueryEscape(b.consumerKey), url.QueryEscape(b.consumerSecret))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded;charset=UTF-8")
+	resp, err := a.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return newApiError(resp, a.errorBodySize())
+	}
+	return json.NewDecoder(resp.Body).Decode(data)
+}
+
+// oauthBaseUrl returns the root of the API, where the oauth and oauth2 endpoints are, from the base URL
+func (a TwitterApi) oauthBaseUrl() string {
+	return strings.TrimSuffix(strings.TrimSuffix(a.baseUrl, "/1.1"), "/1")
+}
@@ -0,0 +1,93 @@
+package anaconda_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/ChimeraCoder/anaconda"
+)
+
+func Test_TwitterApiAppOnly(t *testing.T) {
+	var mu sync.Mutex
+	issued, invalidated, searches := 0, 0, 0
+	valid := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/oauth2/token", "/oauth2/invalidate_token":
+			if key, secret, ok := r.BasicAuth(); !ok || key != "consumer%2Bkey" || secret != "secret" {
+				t.Errorf("Unexpected consumer credentials %q %q", key, secret)
+			}
+			r.ParseForm()
+			if r.URL.Path == "/oauth2/invalidate_token" {
+				invalidated++
+				delete(valid, r.PostForm.Get("access_token"))
+				w.Write([]byte(`{"access_token": "` + r.PostForm.Get("access_token") + `"}`))
+				return
+			}
+			if r.PostForm.Get("grant_type") != "client_credentials" {
+				t.Errorf("Unexpected grant_type %q", r.PostForm.Get("grant_type"))
+			}
+			issued++
+			token := "token" + strconv.Itoa(issued)
+			valid[token] = true
+			w.Write([]byte(`{"token_type": "bearer", "access_token": "` + token + `"}`))
+		case "/search/tweets.json":
+			searches++
+			if !valid[r.Header.Get("Authorization")[len("Bearer "):]] {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"errors": [{"code": 89, "message": "Invalid or expired token."}]}`))
+				return
+			}
+			w.Write([]byte(`{"statuses": []}`))
+		default:
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+	}))
+	defer server.Close()
+
+	api := anaconda.NewTwitterApiAppOnly("consumer+key", "secret")
+	api.SetBaseUrl(server.URL)
+	defer api.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, err := api.GetSearch("golang", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if token, err := api.BearerToken(); err != nil || token != "token1" || issued != 1 {
+		t.Fatalf("Expected the token to be cached, received %q %v after %d token requests", token, err, issued)
+	}
+
+	if err := api.InvalidateBearerToken(); err != nil || invalidated != 1 {
+		t.Fatalf("Expected the token to be invalidated, received %v", err)
+	}
+	if _, err := api.GetSearch("golang", nil); err != nil || issued != 2 {
+		t.Fatalf("Expected a new token after the invalidation, received %v after %d token requests", err, issued)
+	}
+
+	// a token revoked elsewhere is requested again after the 401
+	mu.Lock()
+	delete(valid, "token2")
+	mu.Unlock()
+	if _, err := api.GetSearch("golang", nil); err == nil {
+		t.Fatalf("Expected the revoked token to be rejected")
+	}
+	if _, err := api.GetSearch("golang", nil); err != nil || issued != 3 {
+		t.Fatalf("Expected a new token after the 401, received %v after %d token requests", err, issued)
+	}
+
+	bearerOnly := anaconda.NewTwitterApiWithBearerToken("token3")
+	bearerOnly.SetBaseUrl(server.URL)
+	defer bearerOnly.Close()
+	if _, err := bearerOnly.GetSearch("golang", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := bearerOnly.InvalidateBearerToken(); err != anaconda.ErrNoConsumerCredentials {
+		t.Fatalf("Expected %v, received %v", anaconda.ErrNoConsumerCredentials, err)
+	}
+}
@@ -6,15 +6,13 @@ import (
 )
 
 func (a TwitterApi) GetBlocksList(v url.Values) (c UserCursor, err error) {
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/blocks/list.json", v, &c, _GET, response_ch}
-	return c, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/blocks/list.json", v, &c, _GET)
+	return c, err
 }
 
 func (a TwitterApi) GetBlocksIds(v url.Values) (c Cursor, err error) {
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/blocks/ids.json", v, &c, _GET, response_ch}
-	return c, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/blocks/ids.json", v, &c, _GET)
+	return c, err
 }
 
 func (a TwitterApi) BlockUser(screenName string, v url.Values) (user User, err error) {
@@ -30,9 +28,8 @@ func (a TwitterApi) BlockUserId(id int64, v url.Values) (user User, err error) {
 }
 
 func (a TwitterApi) Block(v url.Values) (user User, err error) {
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/blocks/create.json", v, &user, _POST, response_ch}
-	return user, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/blocks/create.json", v, &user, _POST)
+	return user, err
 }
 
 func (a TwitterApi) UnblockUser(screenName string, v url.Values) (user User, err error) {
@@ -48,7 +45,6 @@ func (a TwitterApi) UnblockUserId(id int64, v url.Values) (user User, err error)
 }
 
 func (a TwitterApi) Unblock(v url.Values) (user User, err error) {
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/blocks/destroy.json", v, &user, _POST, response_ch}
-	return user, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/blocks/destroy.json", v, &user, _POST)
+	return user, err
 }
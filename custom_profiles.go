@@ -0,0 +1,58 @@
+package anaconda
+
+import (
+	"errors"
+	"net/url"
+)
+
+//NewCustomProfile creates a custom profile named name, with the avatar uploaded with UploadMedia as mediaID.
+//Direct messages are sent as the profile with DMMessage.SetCustomProfile.
+//https://developer.twitter.com/en/docs/direct-messages/custom-profiles/api-reference/new-profile
+func (a TwitterApi) NewCustomProfile(name, mediaID string) (profile CustomProfile, err error) {
+	if name == "" || mediaID == "" {
+		return profile, errors.New("anaconda: custom profile requires a name and an avatar media id")
+	}
+	payload := struct {
+		CustomProfile struct {
+			Name   string `json:"name"`
+			Avatar struct {
+				Media struct {
+					ID string `json:"id"`
+				} `json:"media"`
+			} `json:"avatar"`
+		} `json:"custom_profile"`
+	}{}
+	payload.CustomProfile.Name = name
+	payload.CustomProfile.Avatar.Media.ID = mediaID
+
+	resp := struct {
+		CustomProfile *CustomProfile `json:"custom_profile"`
+	}{&profile}
+	err = a.sendJSONQuery(a.baseUrl+"/custom_profiles/new.json", payload, &resp)
+	return profile, err
+}
+
+//GetCustomProfile returns the custom profile with the given id
+//https://developer.twitter.com/en/docs/direct-messages/custom-profiles/api-reference/get-profile
+func (a TwitterApi) GetCustomProfile(id string) (profile CustomProfile, err error) {
+	resp := struct {
+		CustomProfile *CustomProfile `json:"custom_profile"`
+	}{&profile}
+	err = a.sendQuery(a.baseUrl+"/custom_profiles/"+url.PathEscape(id)+".json", nil, &resp, _GET)
+	return profile, err
+}
+
+//GetCustomProfilesList returns a page of the custom profiles, see the count and cursor parameters
+//https://developer.twitter.com/en/docs/direct-messages/custom-profiles/api-reference/get-profile-list
+func (a TwitterApi) GetCustomProfilesList(v url.Values) (list CustomProfileList, err error) {
+	err = a.sendQuery(a.baseUrl+"/custom_profiles/list.json", v, &list, _GET)
+	return list, err
+}
+
+//DeleteCustomProfile deletes the custom profile with the given id
+//https://developer.twitter.com/en/docs/direct-messages/custom-profiles/api-reference/delete-profile
+func (a TwitterApi) DeleteCustomProfile(id string) (err error) {
+	v := url.Values{}
+	v.Set("id", id)
+	return a.sendQuery(a.baseUrl+"/custom_profiles/destroy.json", v, nil, _DELETE)
+}
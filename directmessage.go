@@ -1,5 +1,14 @@
 package anaconda
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
 type DirectMessage struct {
 	CreatedAt           string   `json:"created_at"`
 	Entities            Entities `json:"entities"`
@@ -15,36 +24,333 @@ type DirectMessage struct {
 }
 
 //DMEvent represents the payload of direct message single event
+//https://developer.twitter.com/en/docs/direct-messages/sending-and-receiving/guides/message-create-object
 type DMEvent struct {
-	EventType        string `json:"type"`
-	ID               string `json:"id"`
-	CreatedTimestamp string `json:"created_timestamp"`
-	MessageCreate    struct {
-		Target struct {
-			RecipientID string `json:"recipient_id"`
-		} `json:"target"`
-		SenderID    string      `json:"sender_id"`
-		MessageData MessageData `json:"message_data"`
-	} `json:"message_create"`
+	EventType        string          `json:"type"`
+	ID               string          `json:"id"`
+	CreatedTimestamp string          `json:"created_timestamp"`
+	InitiatedVia     *DMInitiatedVia `json:"initiated_via"`
+	MessageCreate    DMMessageCreate `json:"message_create"`
+
+	// Raw holds the whole event when EventType is not message_create,
+	// so that event types unknown to this package are not lost
+	Raw json.RawMessage `json:"-"`
+}
+
+//DMMessageCreate is the message_create object of a DMEvent
+type DMMessageCreate struct {
+	Target struct {
+		RecipientID string `json:"recipient_id"`
+	} `json:"target"`
+	SenderID        string      `json:"sender_id"`
+	SourceAppID     string      `json:"source_app_id"`
+	CustomProfileID string      `json:"custom_profile_id"`
+	MessageData     MessageData `json:"message_data"`
+}
+
+//DMInitiatedVia tells which Tweet or welcome message started the conversation
+type DMInitiatedVia struct {
+	TweetID          string `json:"tweet_id"`
+	WelcomeMessageID string `json:"welcome_message_id"`
+}
+
+func (e *DMEvent) UnmarshalJSON(data []byte) error {
+	type event DMEvent
+	if err := json.Unmarshal(data, (*event)(e)); err != nil {
+		return err
+	}
+	if e.EventType != "message_create" {
+		e.Raw = append(json.RawMessage(nil), data...)
+	}
+	return nil
 }
 
 //MessageData is the event message_data
 type MessageData struct {
-	Text     string `json:"text"`
-	Entities Entities
+	Text       string `json:"text"`
+	Entities   Entities
 	Attachment Attachment
+
+	// QuickReply is the quick reply offered with the message
+	QuickReply *DMQuickReply `json:"quick_reply"`
+	// QuickReplyResponse is set when the message answers a quick reply
+	QuickReplyResponse *DMQuickReplyResponse `json:"quick_reply_response"`
+	CTAs               []DMCTA               `json:"ctas"`
 }
 
 //Attachment included with the message data
 type Attachment struct {
+	Type  string `json:"type"`
 	Media struct {
+		ID            int64  `json:"id"`
+		IDStr         string `json:"id_str"`
+		Type          string `json:"type"`
+		URL           string `json:"url"`
+		DisplayURL    string `json:"display_url"`
+		ExpandedURL   string `json:"expanded_url"`
 		MediaURL      string `json:"media_url"`
 		MediaUrlHttps string `json:"media_url_https"`
+		Indices       []int  `json:"indices"`
+	}
+}
+
+//DMQuickReply is a quick reply of type options
+type DMQuickReply struct {
+	Type    string               `json:"type"`
+	Options []DMQuickReplyOption `json:"options"`
+}
+
+//DMQuickReplyResponse carries the metadata of the quick reply option picked by the user
+type DMQuickReplyResponse struct {
+	Type     string `json:"type"`
+	Metadata string `json:"metadata"`
+}
+
+// CreatedAtTime is a convenience wrapper that returns the CreatedTimestamp, milliseconds since the epoch, parsed as a time.Time struct
+func (e DMEvent) CreatedAtTime() (time.Time, error) {
+	return parseTimestampMs(e.CreatedTimestamp)
+}
+
+func parseTimestampMs(timestamp string) (time.Time, error) {
+	ms, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, err
 	}
+	return time.Unix(0, ms*int64(time.Millisecond)), nil
+}
+
+//DMParticipants identifies a conversation by the ids of its two participants, the lowest id first
+type DMParticipants [2]string
+
+// Participants returns the conversation of a message_create event,
+// so that messages sent and received in a conversation share the same key
+func (e DMEvent) Participants() DMParticipants {
+	sender, recipient := e.MessageCreate.SenderID, e.MessageCreate.Target.RecipientID
+	if len(sender) > len(recipient) || (len(sender) == len(recipient) && sender > recipient) {
+		sender, recipient = recipient, sender
+	}
+	return DMParticipants{sender, recipient}
 }
 
 //DMEventList ...
 type DMEventList struct {
-	NextCursor string    `json:"next_cursor"`
-	Events     []DMEvent `json:"events"`
+	NextCursor string           `json:"next_cursor"`
+	Events     []DMEvent        `json:"events"`
+	Apps       map[string]DMApp `json:"apps"`
+}
+
+//WelcomeMessage is the message shown to users opening a conversation with the account,
+//see NewWelcomeMessage
+type WelcomeMessage struct {
+	ID               string      `json:"id"`
+	CreatedTimestamp string      `json:"created_timestamp"`
+	SourceAppID      string      `json:"source_app_id"`
+	Name             string      `json:"name"`
+	MessageData      MessageData `json:"message_data"`
+}
+
+//WelcomeMessageList is a page of welcome messages
+type WelcomeMessageList struct {
+	NextCursor      string           `json:"next_cursor"`
+	WelcomeMessages []WelcomeMessage `json:"welcome_messages"`
+	Apps            map[string]DMApp `json:"apps"`
+}
+
+//WelcomeMessageRule makes a welcome message the default one
+type WelcomeMessageRule struct {
+	ID               string `json:"id"`
+	CreatedTimestamp string `json:"created_timestamp"`
+	WelcomeMessageID string `json:"welcome_message_id"`
+}
+
+//WelcomeMessageRuleList is a page of welcome message rules
+type WelcomeMessageRuleList struct {
+	NextCursor          string               `json:"next_cursor"`
+	WelcomeMessageRules []WelcomeMessageRule `json:"welcome_message_rules"`
+}
+
+//CustomProfile is an identity, a name and an avatar, the account can send messages as
+type CustomProfile struct {
+	ID               string `json:"id"`
+	CreatedTimestamp string `json:"created_timestamp"`
+	Name             string `json:"name"`
+	Avatar           struct {
+		Media struct {
+			URL string `json:"url"`
+		} `json:"media"`
+	} `json:"avatar"`
+}
+
+//CustomProfileList is a page of custom profiles
+type CustomProfileList struct {
+	NextCursor     string          `json:"next_cursor"`
+	CustomProfiles []CustomProfile `json:"custom_profiles"`
+}
+
+// Limits of a message_create event, as documented by Twitter
+const (
+	DMTextMaxLength         = 10000
+	DMQuickReplyMaxOptions  = 20
+	DMQuickReplyLabelMax    = 36
+	DMQuickReplyDescMax     = 72
+	DMQuickReplyMetadataMax = 1000
+	DMCTAMaxButtons         = 3
+	DMCTALabelMax           = 36
+)
+
+//DMMessage builds the message_create event published by NewDirectMessage.
+//
+//  m := anaconda.NewDMMessage("4337869213", "What is your favorite color?").
+//      AddQuickReplyOption("Red", "", "external_id_1").
+//      AddQuickReplyOption("Blue", "", "external_id_2")
+//  event, err := api.NewDirectMessage(m)
+type DMMessage struct {
+	RecipientID       string
+	Text              string
+	QuickReplyOptions []DMQuickReplyOption
+	CTAs              []DMCTA
+	MediaID           string
+	CustomProfileID   string
+}
+
+//DMQuickReplyOption is an option of a quick reply of type options
+type DMQuickReplyOption struct {
+	Label       string `json:"label"`
+	Description string `json:"description,omitempty"`
+	Metadata    string `json:"metadata,omitempty"`
+}
+
+//DMCTA is a call-to-action button displayed below the message
+type DMCTA struct {
+	Type  string `json:"type"`
+	Label string `json:"label"`
+	URL   string `json:"url"`
+
+	// TcoURL is the shortened URL, set by Twitter
+	TcoURL string `json:"tco_url,omitempty"`
+}
+
+//NewDMMessage returns a text message to the user identified by recipientID
+func NewDMMessage(recipientID, text string) *DMMessage {
+	return &DMMessage{RecipientID: recipientID, Text: text}
+}
+
+//AddQuickReplyOption adds an option to the quick reply of the message
+func (m *DMMessage) AddQuickReplyOption(label, description, metadata string) *DMMessage {
+	m.QuickReplyOptions = append(m.QuickReplyOptions, DMQuickReplyOption{label, description, metadata})
+	return m
+}
+
+//AddButton adds a call-to-action button opening url
+func (m *DMMessage) AddButton(label, url string) *DMMessage {
+	m.CTAs = append(m.CTAs, DMCTA{Type: "web_url", Label: label, URL: url})
+	return m
+}
+
+//AttachMedia attaches the media previously uploaded with UploadMedia
+func (m *DMMessage) AttachMedia(mediaID string) *DMMessage {
+	m.MediaID = mediaID
+	return m
+}
+
+//SetCustomProfile sends the message on behalf of a custom profile
+func (m *DMMessage) SetCustomProfile(customProfileID string) *DMMessage {
+	m.CustomProfileID = customProfileID
+	return m
+}
+
+//Validate checks the message against the limits documented by Twitter
+func (m *DMMessage) Validate() error {
+	switch {
+	case m == nil:
+		return errors.New("anaconda: nil direct message")
+	case m.RecipientID == "":
+		return errors.New("anaconda: direct message without recipient")
+	}
+	return m.validateMessageData()
+}
+
+// validateMessageData checks the fields of m sent as message_data
+func (m *DMMessage) validateMessageData() error {
+	switch {
+	case m == nil:
+		return errors.New("anaconda: nil direct message")
+	case m.Text == "":
+		return errors.New("anaconda: direct message without text")
+	case utf8.RuneCountInString(m.Text) > DMTextMaxLength:
+		return fmt.Errorf("anaconda: direct message text longer than %d characters", DMTextMaxLength)
+	case len(m.QuickReplyOptions) > DMQuickReplyMaxOptions:
+		return fmt.Errorf("anaconda: direct message with more than %d quick reply options", DMQuickReplyMaxOptions)
+	case len(m.CTAs) > DMCTAMaxButtons:
+		return fmt.Errorf("anaconda: direct message with more than %d buttons", DMCTAMaxButtons)
+	}
+	for _, o := range m.QuickReplyOptions {
+		switch {
+		case o.Label == "" || utf8.RuneCountInString(o.Label) > DMQuickReplyLabelMax:
+			return fmt.Errorf("anaconda: quick reply option label %q must have 1 to %d characters", o.Label, DMQuickReplyLabelMax)
+		case utf8.RuneCountInString(o.Description) > DMQuickReplyDescMax:
+			return fmt.Errorf("anaconda: quick reply option %q description longer than %d characters", o.Label, DMQuickReplyDescMax)
+		case utf8.RuneCountInString(o.Metadata) > DMQuickReplyMetadataMax:
+			return fmt.Errorf("anaconda: quick reply option %q metadata longer than %d characters", o.Label, DMQuickReplyMetadataMax)
+		}
+	}
+	for _, c := range m.CTAs {
+		switch {
+		case c.Label == "" || utf8.RuneCountInString(c.Label) > DMCTALabelMax:
+			return fmt.Errorf("anaconda: button label %q must have 1 to %d characters", c.Label, DMCTALabelMax)
+		case c.URL == "":
+			return fmt.Errorf("anaconda: button %q without url", c.Label)
+		}
+	}
+	return nil
+}
+
+// dmMessageData is the message_data sent by NewDirectMessage and NewWelcomeMessage
+type dmMessageData struct {
+	Text       string        `json:"text"`
+	QuickReply *DMQuickReply `json:"quick_reply,omitempty"`
+	CTAs       []DMCTA       `json:"ctas,omitempty"`
+	Attachment *dmAttachment `json:"attachment,omitempty"`
+}
+
+type dmAttachment struct {
+	Type  string `json:"type"`
+	Media struct {
+		ID string `json:"id"`
+	} `json:"media"`
+}
+
+func (m *DMMessage) messageData() dmMessageData {
+	d := dmMessageData{Text: m.Text, CTAs: m.CTAs}
+	if len(m.QuickReplyOptions) > 0 {
+		d.QuickReply = &DMQuickReply{"options", m.QuickReplyOptions}
+	}
+	if m.MediaID != "" {
+		d.Attachment = &dmAttachment{Type: "media"}
+		d.Attachment.Media.ID = m.MediaID
+	}
+	return d
+}
+
+// payload returns the body of POST direct_messages/events/new
+func (m *DMMessage) payload() interface{} {
+	type messageCreate struct {
+		Target struct {
+			RecipientID string `json:"recipient_id"`
+		} `json:"target"`
+		MessageData     dmMessageData `json:"message_data"`
+		CustomProfileID string        `json:"custom_profile_id,omitempty"`
+	}
+	type event struct {
+		Type          string        `json:"type"`
+		MessageCreate messageCreate `json:"message_create"`
+	}
+
+	e := event{Type: "message_create"}
+	e.MessageCreate.Target.RecipientID = m.RecipientID
+	e.MessageCreate.MessageData = m.messageData()
+	e.MessageCreate.CustomProfileID = m.CustomProfileID
+	return struct {
+		Event event `json:"event"`
+	}{e}
 }
@@ -1,37 +1,99 @@
 package anaconda
 
 import (
-	"bytes"
-	"encoding/json"
-	"errors"
-	"io"
 	"net/http"
 	"net/url"
 	"strconv"
+	"time"
 )
 
+type DMEventsPage struct {
+	Events []DMEvent
+	Error  error
+}
+
 //GetDirectMessagesList Returns all Direct Message events (both sent and received) within the last 30 days.
 //Sorted in reverse-chronological order.
 //https://developer.twitter.com/en/docs/direct-messages/sending-and-receiving/api-reference/list-events
 func (a TwitterApi) GetDirectMessagesList(v url.Values) (messages DMEventList, err error) {
-	responseCh := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/direct_messages/events/list.json", v, &messages, _GET, responseCh}
-	return messages, (<-responseCh).err
+	err = a.sendQuery(a.baseUrl+"/direct_messages/events/list.json", v, &messages, _GET)
+	return messages, err
+}
+
+// Like GetDirectMessagesList, but returns a channel instead of a cursor and pre-fetches the remaining results
+// This channel is closed once all values have been fetched
+func (a TwitterApi) GetDirectMessagesListAll(v url.Values) (result chan DMEventsPage) {
+	return a.GetDirectMessagesListUntil(v, "", time.Time{})
+}
+
+// Like GetDirectMessagesListAll, but stops before the event with id untilID or the first event created at or before until,
+// whichever comes first. Events are returned from the most recent, so that an incremental sync only fetches
+// the events published since the last one it saw. An empty untilID or a zero until is ignored.
+// This channel is closed once all values have been fetched
+func (a TwitterApi) GetDirectMessagesListUntil(v url.Values, untilID string, until time.Time) (result chan DMEventsPage) {
+	result = make(chan DMEventsPage)
+
+	v = cleanValues(v)
+	go func(a TwitterApi, v url.Values, result chan DMEventsPage) {
+		defer close(result)
+		for {
+			c, err := a.GetDirectMessagesList(v)
+
+			events, stop := c.Events, false
+			for i, e := range events {
+				if e.ID == untilID && untilID != "" {
+					events, stop = events[:i], true
+					break
+				}
+				if t, terr := e.CreatedAtTime(); terr == nil && !until.IsZero() && !t.After(until) {
+					events, stop = events[:i], true
+					break
+				}
+			}
+			result <- DMEventsPage{events, err}
+
+			if err != nil || stop || c.NextCursor == "" {
+				return
+			}
+			v.Set("cursor", c.NextCursor)
+		}
+	}(a, v, result)
+	return result
+}
+
+// GetDirectMessageConversations fetches the events of GetDirectMessagesListUntil and groups the message_create
+// events by conversation. The events of each conversation are sorted from the most recent.
+// Events fetched before an error are returned along with it.
+func (a TwitterApi) GetDirectMessageConversations(v url.Values, untilID string, until time.Time) (conversations map[DMParticipants][]DMEvent, err error) {
+	conversations = make(map[DMParticipants][]DMEvent)
+	for page := range a.GetDirectMessagesListUntil(v, untilID, until) {
+		for _, e := range page.Events {
+			if e.EventType == "message_create" {
+				p := e.Participants()
+				conversations[p] = append(conversations[p], e)
+			}
+		}
+		if page.Error != nil {
+			err = page.Error
+		}
+	}
+	return conversations, err
 }
 
 //GetDirectMessagesSent deprecated
 func (a TwitterApi) GetDirectMessagesSent(v url.Values) (messages []DirectMessage, err error) {
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/direct_messages/sent.json", v, &messages, _GET, response_ch}
-	return messages, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/direct_messages/sent.json", v, &messages, _GET)
+	return messages, err
 }
 
 //GetDirectMessagesShow Returns a single Direct Message event by the given id.
 //https://developer.twitter.com/en/docs/direct-messages/sending-and-receiving/api-reference/get-event
-func (a TwitterApi) GetDirectMessagesShow(v url.Values) (message DirectMessage, err error) {
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/direct_messages/events/show.json", v, &message, _GET, response_ch}
-	return message, (<-response_ch).err
+func (a TwitterApi) GetDirectMessagesShow(v url.Values) (event DMEvent, err error) {
+	resp := struct {
+		Event *DMEvent `json:"event"`
+	}{&event}
+	err = a.sendQuery(a.baseUrl+"/direct_messages/events/show.json", v, &resp, _GET)
+	return event, err
 }
 
 //PostDMToScreenName deprecated
@@ -57,16 +119,14 @@ func (a TwitterApi) PostDMToUserId(text string, userId int64) (message DirectMes
 func (a TwitterApi) DeleteDirectMessage(id int64, includeEntities bool) (message DirectMessage, err error) {
 	v := url.Values{}
 	v.Set("id", strconv.FormatInt(id, 10))
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/direct_messages/events/destroy.json", v, &message, _POST, response_ch}
-	return message, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/direct_messages/events/destroy.json", v, &message, _POST)
+	return message, err
 }
 
 //postDirectMessagesImpl un-used
 func (a TwitterApi) postDirectMessagesImpl(v url.Values) (message DirectMessage, err error) {
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/direct_messages/new.json", v, &message, _POST, response_ch}
-	return message, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/direct_messages/new.json", v, &message, _POST)
+	return message, err
 }
 
 // IndicateTyping will create a typing indicator
@@ -74,73 +134,54 @@ func (a TwitterApi) postDirectMessagesImpl(v url.Values) (message DirectMessage,
 func (a TwitterApi) IndicateTyping(id int64) (err error) {
 	v := url.Values{}
 	v.Set("recipient_id", strconv.FormatInt(id, 10))
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/direct_messages/indicate_typing.json", v, nil, _POST, response_ch}
-	return (<-response_ch).err
+	return a.sendQuery(a.baseUrl+"/direct_messages/indicate_typing.json", v, nil, _POST)
+}
+
+// MarkDirectMessagesRead marks the messages of the conversation with recipientID as read,
+// up to the event lastReadEventID
+// https://developer.twitter.com/en/docs/direct-messages/typing-indicator-and-read-receipts/api-reference/new-read-receipt
+func (a TwitterApi) MarkDirectMessagesRead(lastReadEventID, recipientID string) (err error) {
+	v := url.Values{}
+	v.Set("last_read_event_id", lastReadEventID)
+	v.Set("recipient_id", recipientID)
+	return a.sendQuery(a.baseUrl+"/direct_messages/mark_read.json", v, nil, _POST)
 }
 
 //NewDirectMessage Publishes a new message_create event resulting in a Direct Message sent to a specified user from the authenticating user.
 //Returns an event if successful. Supports publishing Direct Messages with optional Quick Reply and media attachment.
 //Replaces behavior currently provided by POST direct_messages/new.
+//The message is validated before it is sent, see DMMessage.
 //https://developer.twitter.com/en/docs/direct-messages/sending-and-receiving/api-reference/new-event
-func (a TwitterApi) NewDirectMessage(jd []byte) (rsBody []byte, err error) {
-	result := make(map[string]interface{})
-	res, err := a.Do(a.HttpClient, a.baseUrl+"/direct_messages/events/new.json", jd)
-	if err != nil {
-		return nil, err
-	}
-	defer res.Body.Close()
-	result = decodeRespBody(res.Body)
-	rsBody, err = json.Marshal(result)
-	if err != nil {
-		return nil, err
+func (a TwitterApi) NewDirectMessage(m *DMMessage) (event DMEvent, err error) {
+	if err = m.Validate(); err != nil {
+		return event, err
 	}
-	return rsBody, nil
+	resp := struct {
+		Event *DMEvent `json:"event"`
+	}{&event}
+	err = a.sendJSONQuery(a.baseUrl+"/direct_messages/events/new.json", m.payload(), &resp)
+	return event, err
 }
 
 //Do execute the send query by http client
 // It will return the result as *http.Response
 func (a TwitterApi) Do(client *http.Client, urlStr string, jd []byte) (*http.Response, error) {
 	req, err := a.doHttpReq(client, urlStr, "POST", jd)
-	if err != nil{
+	if err != nil {
 		return nil, err
 	}
 	return client.Do(req)
 }
 
-func decodeRespBody(wr io.Reader) (body map[string]interface{}) {
-	body = make(map[string]interface{})
-	json.NewDecoder(wr).Decode(&body)
-	return body
-}
-
-func (a TwitterApi) doHttpReq(client *http.Client, URL, method string, reader []byte)(*http.Request, error){
-	rb :=  bytes.NewReader(reader)
-	req, err := http.NewRequest(method, URL, rb)
-	if err != nil {
-		return nil, err
-	}
-	if req.URL.RawQuery != "" {
-		return nil, errors.New("oauth: url must not contain a query string")
-	}
-	c := a.oauthClient
-	for k, v := range c.Header {
-		req.Header[k] = v
-	}
-	auth := c.AuthorizationHeader(a.Credentials, method, req.URL, nil)
-	req.Header.Set("Authorization", auth)
-	req.Header.Set("Content-Type", "application/json")
-	if client == nil {
-		client = http.DefaultClient
-	}
-	return req, nil
+func (a TwitterApi) doHttpReq(client *http.Client, URL, method string, reader []byte) (*http.Request, error) {
+	return a.newJSONRequest(a.Context(), method, URL, reader)
 }
 
 //GetDirectMessagesMedia fetch direct messages media
 func (a TwitterApi) GetDirectMessagesMedia(mediaURL string, v url.Values) (*http.Response, error) {
 	client := a.HttpClient
 	req, err := a.doHttpReq(client, mediaURL, "GET", nil)
-	if err != nil{
+	if err != nil {
 		return nil, err
 	}
 	return client.Do(req)
@@ -0,0 +1,268 @@
+package anaconda_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChimeraCoder/anaconda"
+)
+
+func Test_NewDirectMessage(t *testing.T) {
+	var sent interface{}
+	apiLocal := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/direct_messages/events/new.json" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Expected a JSON payload, received Content-Type %q", ct)
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "OAuth ") {
+			t.Errorf("Expected a signed request")
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &sent); err != nil {
+			t.Errorf("Cannot decode payload %s: %s", body, err)
+		}
+		w.Write([]byte(`{"event": {"type": "message_create", "id": "1060", "created_timestamp": "1516403560557",
+			"message_create": {"target": {"recipient_id": "4337869213"}, "sender_id": "3001969357", "message_data": {"text": "Pick one"}}}}`))
+	})
+
+	m := anaconda.NewDMMessage("4337869213", "Pick one").
+		AddQuickReplyOption("Red", "", "external_id_1").
+		AddQuickReplyOption("Blue", "The sky", "").
+		AddButton("Docs", "https://example.com").
+		AttachMedia("710511363345354753").
+		SetCustomProfile("100001")
+	event, err := apiLocal.NewDirectMessage(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.ID != "1060" || event.MessageCreate.SenderID != "3001969357" || event.MessageCreate.MessageData.Text != "Pick one" {
+		t.Fatalf("Unexpected event %+v", event)
+	}
+
+	var expected interface{}
+	json.Unmarshal([]byte(`{"event": {"type": "message_create", "message_create": {
+		"target": {"recipient_id": "4337869213"},
+		"message_data": {
+			"text": "Pick one",
+			"quick_reply": {"type": "options", "options": [{"label": "Red", "metadata": "external_id_1"}, {"label": "Blue", "description": "The sky"}]},
+			"ctas": [{"type": "web_url", "label": "Docs", "url": "https://example.com"}],
+			"attachment": {"type": "media", "media": {"id": "710511363345354753"}}
+		},
+		"custom_profile_id": "100001"}}}`), &expected)
+	if !reflect.DeepEqual(sent, expected) {
+		t.Fatalf("Unexpected payload\n%v\nexpected\n%v", sent, expected)
+	}
+}
+
+func Test_NewDirectMessage_Errors(t *testing.T) {
+	requests := 0
+	apiLocal := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"errors": [{"code": 349, "message": "You cannot send messages to this user."}]}`))
+	})
+
+	invalid := []*anaconda.DMMessage{
+		anaconda.NewDMMessage("", "text"),
+		anaconda.NewDMMessage("4337869213", ""),
+		anaconda.NewDMMessage("4337869213", strings.Repeat("a", anaconda.DMTextMaxLength+1)),
+		anaconda.NewDMMessage("4337869213", "text").AddQuickReplyOption(strings.Repeat("a", anaconda.DMQuickReplyLabelMax+1), "", ""),
+		anaconda.NewDMMessage("4337869213", "text").AddButton("1", "u").AddButton("2", "u").AddButton("3", "u").AddButton("4", "u"),
+	}
+	for _, m := range invalid {
+		if _, err := apiLocal.NewDirectMessage(m); err == nil {
+			t.Errorf("Expected a validation error for %+v", m)
+		}
+	}
+	if requests != 0 {
+		t.Fatalf("Invalid messages were sent")
+	}
+
+	_, err := apiLocal.NewDirectMessage(anaconda.NewDMMessage("4337869213", "text"))
+	apiErr, ok := err.(*anaconda.ApiError)
+	if !ok {
+		t.Fatalf("Expected an *ApiError, received %#v", err)
+	}
+	if apiErr.StatusCode != http.StatusForbidden || len(apiErr.Decoded.Errors) != 1 || apiErr.Decoded.Errors[0].Code != 349 {
+		t.Fatalf("Unexpected error %+v", apiErr)
+	}
+}
+
+func Test_GetDirectMessagesShow(t *testing.T) {
+	apiLocal := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/direct_messages/events/show.json" || r.URL.Query().Get("id") != "1066903366071214084" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+		}
+		w.Write([]byte(`{"event": {"type": "message_create", "id": "1066903366071214084", "created_timestamp": "1543174223489",
+			"message_create": {"target": {"recipient_id": "1063174963806330881"}, "sender_id": "1063174963806330881",
+				"message_data": {"text": "test", "entities": {"hashtags": [], "symbols": [], "user_mentions": [], "urls": []}}}}}`))
+	})
+
+	event, err := apiLocal.GetDirectMessagesShow(url.Values{"id": {"1066903366071214084"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.ID != "1066903366071214084" || event.EventType != "message_create" ||
+		event.MessageCreate.Target.RecipientID != "1063174963806330881" || event.MessageCreate.MessageData.Text != "test" {
+		t.Fatalf("Unexpected event %+v", event)
+	}
+}
+
+func Test_GetDirectMessagesListUntil(t *testing.T) {
+	pages := map[string]string{
+		"": `{"next_cursor": "page2", "events": [
+			{"type": "message_create", "id": "5", "created_timestamp": "1516403560500", "message_create": {"target": {"recipient_id": "20"}, "sender_id": "100"}},
+			{"type": "message_create", "id": "4", "created_timestamp": "1516403560400", "message_create": {"target": {"recipient_id": "100"}, "sender_id": "20"}}]}`,
+		"page2": `{"events": [
+			{"type": "message_create", "id": "3", "created_timestamp": "1516403560300", "message_create": {"target": {"recipient_id": "30"}, "sender_id": "20"}},
+			{"type": "message_create", "id": "2", "created_timestamp": "1516403560200", "message_create": {"target": {"recipient_id": "100"}, "sender_id": "20"}}]}`,
+	}
+	requests := 0
+	apiLocal := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		page, ok := pages[r.URL.Query().Get("cursor")]
+		if !ok {
+			t.Errorf("Unexpected cursor %q", r.URL.Query().Get("cursor"))
+		}
+		w.Write([]byte(page))
+	})
+
+	ids := func(result chan anaconda.DMEventsPage) (ids []string) {
+		for page := range result {
+			if page.Error != nil {
+				t.Fatal(page.Error)
+			}
+			for _, e := range page.Events {
+				ids = append(ids, e.ID)
+			}
+		}
+		return ids
+	}
+
+	if all := ids(apiLocal.GetDirectMessagesListAll(nil)); !reflect.DeepEqual(all, []string{"5", "4", "3", "2"}) {
+		t.Fatalf("Unexpected events %v", all)
+	}
+
+	requests = 0
+	if recent := ids(apiLocal.GetDirectMessagesListUntil(nil, "4", time.Time{})); !reflect.DeepEqual(recent, []string{"5"}) || requests != 1 {
+		t.Fatalf("Unexpected events %v after %d requests, expected to stop at event 4", recent, requests)
+	}
+
+	until := time.Unix(0, 1516403560300*int64(time.Millisecond))
+	if recent := ids(apiLocal.GetDirectMessagesListUntil(nil, "", until)); !reflect.DeepEqual(recent, []string{"5", "4"}) {
+		t.Fatalf("Unexpected events %v, expected to stop at %s", recent, until)
+	}
+
+	conversations, err := apiLocal.GetDirectMessageConversations(nil, "", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conversations) != 2 || len(conversations[anaconda.DMParticipants{"20", "100"}]) != 3 || len(conversations[anaconda.DMParticipants{"20", "30"}]) != 1 {
+		t.Fatalf("Unexpected conversations %v", conversations)
+	}
+
+	created, err := conversations[anaconda.DMParticipants{"20", "30"}][0].CreatedAtTime()
+	if err != nil || !created.Equal(until) {
+		t.Fatalf("Expected event 3 to be created at %s, received %s (%v)", until, created, err)
+	}
+}
+
+func Test_DMEvent_FullModel(t *testing.T) {
+	var list anaconda.DMEventList
+	err := json.Unmarshal([]byte(`{"events": [
+		{"type": "message_create", "id": "1", "created_timestamp": "1516403560557",
+			"initiated_via": {"welcome_message_id": "844385345234"},
+			"message_create": {"target": {"recipient_id": "4337869213"}, "sender_id": "3001969357", "source_app_id": "13090192",
+				"message_data": {"text": "Red", "quick_reply_response": {"type": "options", "metadata": "external_id_1"},
+					"ctas": [{"type": "web_url", "label": "Docs", "url": "https://example.com", "tco_url": "https://t.co/abc"}]}}},
+		{"type": "message_delete", "id": "2", "created_timestamp": "1516403560600"}],
+		"apps": {"13090192": {"id": "13090192", "name": "FindingMyBot"}}}`), &list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := list.Events[0]
+	if e.InitiatedVia == nil || e.InitiatedVia.WelcomeMessageID != "844385345234" || e.MessageCreate.SourceAppID != "13090192" {
+		t.Errorf("Unexpected message_create event %+v", e)
+	}
+	if r := e.MessageCreate.MessageData.QuickReplyResponse; r == nil || r.Metadata != "external_id_1" {
+		t.Errorf("Unexpected quick reply response %+v", r)
+	}
+	if ctas := e.MessageCreate.MessageData.CTAs; len(ctas) != 1 || ctas[0].TcoURL != "https://t.co/abc" {
+		t.Errorf("Unexpected CTAs %+v", ctas)
+	}
+	if e.Raw != nil {
+		t.Errorf("Expected no raw payload for a message_create event")
+	}
+	if list.Apps[e.MessageCreate.SourceAppID].Name != "FindingMyBot" {
+		t.Errorf("Unexpected apps %+v", list.Apps)
+	}
+
+	if other := list.Events[1]; other.EventType != "message_delete" || !strings.Contains(string(other.Raw), `"message_delete"`) {
+		t.Errorf("Expected the raw payload of an unknown event type, received %+v", other)
+	}
+}
+
+func Test_WelcomeMessagesAndProfiles(t *testing.T) {
+	type request struct{ method, path, query, body string }
+	var requests []request
+	apiLocal := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, request{r.Method, r.URL.Path, r.URL.RawQuery, string(body)})
+		switch r.URL.Path {
+		case "/direct_messages/welcome_messages/new.json":
+			w.Write([]byte(`{"welcome_message": {"id": "844385345234", "name": "greeting", "message_data": {"text": "Welcome!"}}}`))
+		case "/direct_messages/welcome_messages/rules/new.json":
+			w.Write([]byte(`{"welcome_message_rule": {"id": "9910934913490319", "welcome_message_id": "844385345234"}}`))
+		case "/direct_messages/welcome_messages/list.json":
+			w.Write([]byte(`{"welcome_messages": [{"id": "844385345234"}], "next_cursor": "NDUzNDUzNDY3Nzc3"}`))
+		case "/custom_profiles/new.json":
+			w.Write([]byte(`{"custom_profile": {"id": "100001", "name": "Jon C, Partner Engineer", "avatar": {"media": {"url": "https://pbs.twimg.com/media/DL.jpg"}}}}`))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	message, err := apiLocal.NewWelcomeMessage("greeting", &anaconda.DMMessage{Text: "Welcome!"})
+	if err != nil || message.ID != "844385345234" || message.MessageData.Text != "Welcome!" {
+		t.Fatalf("Unexpected welcome message %+v (%v)", message, err)
+	}
+	rule, err := apiLocal.NewWelcomeMessageRule(message.ID)
+	if err != nil || rule.WelcomeMessageID != message.ID {
+		t.Fatalf("Unexpected welcome message rule %+v (%v)", rule, err)
+	}
+	list, err := apiLocal.GetWelcomeMessagesList(nil)
+	if err != nil || len(list.WelcomeMessages) != 1 || list.NextCursor != "NDUzNDUzNDY3Nzc3" {
+		t.Fatalf("Unexpected welcome messages %+v (%v)", list, err)
+	}
+	if err := apiLocal.DeleteWelcomeMessage(message.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := apiLocal.MarkDirectMessagesRead("1", "4337869213"); err != nil {
+		t.Fatal(err)
+	}
+	profile, err := apiLocal.NewCustomProfile("Jon C, Partner Engineer", "710511363345354753")
+	if err != nil || profile.ID != "100001" || profile.Avatar.Media.URL == "" {
+		t.Fatalf("Unexpected custom profile %+v (%v)", profile, err)
+	}
+
+	expected := []request{
+		{"POST", "/direct_messages/welcome_messages/new.json", "", `{"welcome_message":{"name":"greeting","message_data":{"text":"Welcome!"}}}`},
+		{"POST", "/direct_messages/welcome_messages/rules/new.json", "", `{"welcome_message_rule":{"welcome_message_id":"844385345234"}}`},
+		{"GET", "/direct_messages/welcome_messages/list.json", "", ""},
+		{"DELETE", "/direct_messages/welcome_messages/destroy.json", "id=844385345234", ""},
+		{"POST", "/direct_messages/mark_read.json", "", "last_read_event_id=1&recipient_id=4337869213"},
+		{"POST", "/custom_profiles/new.json", "", `{"custom_profile":{"name":"Jon C, Partner Engineer","avatar":{"media":{"id":"710511363345354753"}}}}`},
+	}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Fatalf("Unexpected requests\n%q\nexpected\n%q", requests, expected)
+	}
+}
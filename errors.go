@@ -2,7 +2,9 @@ package anaconda
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -13,8 +15,11 @@ import (
 const (
 	//Error code defintions match the Twitter documentation
 	//https://developer.twitter.com/en/docs/basics/response-codes
+	TwitterErrorNoUserMatches           = 17
 	TwitterErrorCouldNotAuthenticate    = 32
 	TwitterErrorDoesNotExist            = 34
+	TwitterErrorUserNotFound            = 50
+	TwitterErrorUserSuspended           = 63
 	TwitterErrorAccountSuspended        = 64
 	TwitterErrorApi1Deprecation         = 68 //This should never be needed
 	TwitterErrorRateLimitExceeded       = 88
@@ -22,6 +27,7 @@ const (
 	TwitterErrorOverCapacity            = 130
 	TwitterErrorInternalError           = 131
 	TwitterErrorCouldNotAuthenticateYou = 135
+	TwitterErrorProtectedStatus         = 179
 	TwitterErrorStatusIsADuplicate      = 187
 	TwitterErrorBadAuthenticationData   = 215
 	TwitterErrorUserMustVerifyLogin     = 231
@@ -30,36 +36,177 @@ const (
 	TwitterErrorDoesNotExist2 = 144
 )
 
+// Sentinel errors to test the errors of the API with errors.Is, instead of the status and the codes of an ApiError:
+//
+//    if errors.Is(err, anaconda.ErrNotFound) {
+//        // the tweet was deleted
+//    }
+//
+// An ApiError matches the sentinels of its status and of every code of its decoded errors.
+var (
+	// HTTP 429 or 420, code 88
+	ErrRateLimited = errors.New("anaconda: rate limit exceeded")
+	// HTTP 404, codes 17, 34, 50 and 144
+	ErrNotFound = errors.New("anaconda: not found")
+	// Code 187
+	ErrDuplicateStatus = errors.New("anaconda: status is a duplicate")
+	// Codes 63 and 64
+	ErrSuspended = errors.New("anaconda: account suspended")
+	// Code 89
+	ErrInvalidToken = errors.New("anaconda: invalid or expired token")
+	// Code 179, the status of a protected account
+	ErrProtected = errors.New("anaconda: not authorized to see the status of a protected account")
+	// Codes 32, 135 and 215
+	ErrCouldNotAuthenticate = errors.New("anaconda: could not authenticate")
+	// Code 130, Twitter did not process the request
+	ErrOverCapacity = errors.New("anaconda: over capacity")
+	// HTTP 503, which without code 130 does not tell whether the request was processed
+	ErrServiceUnavailable = errors.New("anaconda: service unavailable")
+	// HTTP 500, code 131
+	ErrInternalError = errors.New("anaconda: internal error")
+)
+
+// codeErrors maps the error codes of Twitter to the sentinel errors
+var codeErrors = map[int]error{
+	TwitterErrorRateLimitExceeded:       ErrRateLimited,
+	TwitterErrorNoUserMatches:           ErrNotFound,
+	TwitterErrorDoesNotExist:            ErrNotFound,
+	TwitterErrorDoesNotExist2:           ErrNotFound,
+	TwitterErrorUserNotFound:            ErrNotFound,
+	TwitterErrorStatusIsADuplicate:      ErrDuplicateStatus,
+	TwitterErrorUserSuspended:           ErrSuspended,
+	TwitterErrorAccountSuspended:        ErrSuspended,
+	TwitterErrorInvalidToken:            ErrInvalidToken,
+	TwitterErrorProtectedStatus:         ErrProtected,
+	TwitterErrorCouldNotAuthenticate:    ErrCouldNotAuthenticate,
+	TwitterErrorCouldNotAuthenticateYou: ErrCouldNotAuthenticate,
+	TwitterErrorBadAuthenticationData:   ErrCouldNotAuthenticate,
+	TwitterErrorOverCapacity:            ErrOverCapacity,
+	TwitterErrorInternalError:           ErrInternalError,
+}
+
+// statusErrors maps the HTTP statuses of the API to the sentinel errors
+var statusErrors = map[int]error{
+	http.StatusTooManyRequests:     ErrRateLimited,
+	420:                            ErrRateLimited, // Enhance Your Calm
+	http.StatusNotFound:            ErrNotFound,
+	http.StatusServiceUnavailable:  ErrServiceUnavailable,
+	http.StatusInternalServerError: ErrInternalError,
+}
+
+// sentinelError is an error of its own which also matches a sentinel error with errors.Is
+type sentinelError struct {
+	msg      string
+	sentinel error
+}
+
+func (e *sentinelError) Error() string {
+	return e.msg
+}
+
+func (e *sentinelError) Unwrap() error {
+	return e.sentinel
+}
+
+// DefaultMaxErrorBodySize is how many bytes of the body of an error response are read by default, see SetMaxErrorBodySize
+const DefaultMaxErrorBodySize = 64 << 10
+
 type ApiError struct {
 	StatusCode int
 	Header     http.Header
 	Body       string
 	Decoded    TwitterErrorResponse
 	URL        *url.URL
+
+	// Method is the HTTP method of the request
+	Method string
+
+	// RateLimit is the state of the rate limit of the endpoint family, nil when the response has no rate limit headers
+	RateLimit *RateLimit
+
+	// BodyTruncated reports whether the body was longer than the maximum size, and Body cut at it
+	BodyTruncated bool
 }
 
-func newApiError(resp *http.Response) *ApiError {
-	// TODO don't ignore this error
-	// TODO don't use ReadAll
-	p, _ := ioutil.ReadAll(resp.Body)
+// NewApiError reads the error of resp, at most DefaultMaxErrorBodySize bytes of its body
+func NewApiError(resp *http.Response) *ApiError {
+	return newApiError(resp, DefaultMaxErrorBodySize)
+}
 
-	var twitterErrorResp TwitterErrorResponse
-	_ = json.Unmarshal(p, &twitterErrorResp)
-	return &ApiError{
+// newApiError reads the error of resp, at most maxBodySize bytes of its body, decompressed
+func newApiError(resp *http.Response, maxBodySize int64) *ApiError {
+	aerr := &ApiError{
 		StatusCode: resp.StatusCode,
 		Header:     resp.Header,
-		Body:       string(p),
-		Decoded:    twitterErrorResp,
 		URL:        resp.Request.URL,
+		Method:     resp.Request.Method,
+	}
+	if l, ok := parseRateLimit(rateLimitResource(resp.Request.URL), resp.Header); ok {
+		aerr.RateLimit = &l
+	}
+
+	body, err := responseBody(resp)
+	if err != nil {
+		// not compressed as announced, keep it as it is
+		body = resp.Body
+	}
+	// A failed read leaves the part read before, which is all there is to report
+	p, _ := ioutil.ReadAll(io.LimitReader(body, maxBodySize+1))
+	if int64(len(p)) > maxBodySize {
+		p = p[:maxBodySize]
+		aerr.BodyTruncated = true
 	}
+	aerr.Body = string(p)
+	// Bodies which are not Twitter errors, such as HTML pages, leave Decoded empty
+	_ = json.Unmarshal(p, &aerr.Decoded)
+	return aerr
 }
 
 // ApiError supports the error interface
 func (aerr ApiError) Error() string {
-	return fmt.Sprintf("Get %s returned status %d, %s", aerr.URL, aerr.StatusCode, aerr.Body)
+	method := aerr.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	return fmt.Sprintf("%s %s returned status %d, %s", method, aerr.URL, aerr.StatusCode, aerr.detail())
+}
+
+// detail is the body of a JSON response, or the status text of the others, such as the HTML pages of the 5xx errors
+func (aerr ApiError) detail() string {
+	if json.Valid([]byte(aerr.Body)) && !aerr.BodyTruncated {
+		return aerr.Body
+	}
+	if aerr.Body == "" {
+		return http.StatusText(aerr.StatusCode)
+	}
+	if aerr.BodyTruncated {
+		return fmt.Sprintf("%s (body over %d bytes)", http.StatusText(aerr.StatusCode), len(aerr.Body))
+	}
+	return fmt.Sprintf("%s (%d bytes of non-JSON body)", http.StatusText(aerr.StatusCode), len(aerr.Body))
+}
+
+// Is reports whether target is the sentinel error of the HTTP status or of one of the decoded error codes,
+// see ErrNotFound. It does not rely on Unwrap, so that the sentinels match with any version of Go.
+func (aerr *ApiError) Is(target error) bool {
+	if sentinel, ok := statusErrors[aerr.StatusCode]; ok && sentinel == target {
+		return true
+	}
+	return aerr.Decoded.Is(target)
+}
+
+// Unwrap returns the decoded errors, so that errors.As finds the TwitterError of the first code.
+// errors.As only follows it from Go 1.20.
+func (aerr *ApiError) Unwrap() []error {
+	errs := make([]error, len(aerr.Decoded.Errors))
+	for i, e := range aerr.Decoded.Errors {
+		errs[i] = e
+	}
+	return errs
 }
 
 // Check to see if an error is a Rate Limiting error. If so, find the next available window in the header.
+// Rate limits are reported with HTTP 429, HTTP 420 "Enhance Your Calm" or the error code 88.
+// When the reset header is missing or more than an hour away, the next window is assumed to start in 15 minutes.
 // Use like so:
 //
 //    if aerr, ok := err.(*ApiError); ok {
@@ -69,40 +216,66 @@ func (aerr ApiError) Error() string {
 //    }
 //
 func (aerr *ApiError) RateLimitCheck() (isRateLimitError bool, nextWindow time.Time) {
-	// TODO  check for error code 130, which also signifies a rate limit
-	if aerr.StatusCode == 429 {
-		if reset := aerr.Header.Get("X-Rate-Limit-Reset"); reset != "" {
-			if resetUnix, err := strconv.ParseInt(reset, 10, 64); err == nil {
-				resetTime := time.Unix(resetUnix, 0)
-				// Reject any time greater than an hour away
-				if resetTime.Sub(time.Now()) > time.Hour {
-					return true, time.Now().Add(15 * time.Minute)
-				}
+	// Over capacity (130) is not a rate limit, see RetryPolicy
+	if !errors.Is(aerr, ErrRateLimited) {
+		return false, time.Time{}
+	}
 
+	if reset := aerr.Header.Get("X-Rate-Limit-Reset"); reset != "" {
+		if resetUnix, err := strconv.ParseInt(reset, 10, 64); err == nil {
+			resetTime := time.Unix(resetUnix, 0)
+			// Reject any time greater than an hour away
+			if resetTime.Sub(time.Now()) <= time.Hour {
 				return true, resetTime
 			}
 		}
 	}
-
-	return false, time.Time{}
+	return true, time.Now().Add(15 * time.Minute)
 }
 
 //TwitterErrorResponse has an array of Twitter error messages
 //It satisfies the "error" interface
 //For the most part, Twitter seems to return only a single error message
-//Currently, we assume that this always contains exactly one error message
+//The response of a body which is not a Twitter error, such as an HTML page, has no error message
 type TwitterErrorResponse struct {
 	Errors []TwitterError `json:"errors"`
 }
 
+// First returns the first error message, or nil if there is none
 func (tr TwitterErrorResponse) First() error {
+	if len(tr.Errors) == 0 {
+		return nil
+	}
 	return tr.Errors[0]
 }
 
 func (tr TwitterErrorResponse) Error() string {
+	if len(tr.Errors) == 0 {
+		return "anaconda: no Twitter error message"
+	}
 	return tr.Errors[0].Message
 }
 
+// Is reports whether target is the sentinel error of one of the codes, see ErrNotFound
+func (tr TwitterErrorResponse) Is(target error) bool {
+	for _, e := range tr.Errors {
+		if e.Is(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Unwrap returns the error messages, so that errors.As finds their TwitterError.
+// errors.As only follows it from Go 1.20.
+func (tr TwitterErrorResponse) Unwrap() []error {
+	errs := make([]error, len(tr.Errors))
+	for i, e := range tr.Errors {
+		errs[i] = e
+	}
+	return errs
+}
+
 //TwitterError represents a single Twitter error messages/code pair
 type TwitterError struct {
 	Message string `json:"message"`
@@ -112,3 +285,9 @@ type TwitterError struct {
 func (te TwitterError) Error() string {
 	return te.Message
 }
+
+// Is reports whether target is the sentinel error of the code, see ErrNotFound
+func (te TwitterError) Is(target error) bool {
+	sentinel, ok := codeErrors[te.Code]
+	return ok && sentinel == target
+}
@@ -0,0 +1,157 @@
+package anaconda_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ChimeraCoder/anaconda"
+)
+
+func Test_ApiError_Is(t *testing.T) {
+	var status int
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	api := anaconda.NewTwitterApiWithCredentials("token", "secret", "consumer", "consumersecret")
+	api.SetBaseUrl(server.URL)
+	api.ReturnRateLimitError(true)
+	defer api.Close()
+
+	for _, c := range []struct {
+		status   int
+		body     string
+		expected []error
+	}{
+		{404, `{"errors": [{"code": 144, "message": "No status found with that ID."}]}`, []error{anaconda.ErrNotFound}},
+		{403, `{"errors": [{"code": 187, "message": "Status is a duplicate."}]}`, []error{anaconda.ErrDuplicateStatus}},
+		{403, `{"errors": [{"code": 179, "message": "Sorry, you are not authorized to see this status."}]}`, []error{anaconda.ErrProtected}},
+		{401, `{"errors": [{"code": 89, "message": "Invalid or expired token."}, {"code": 64, "message": "Your account is suspended."}]}`,
+			[]error{anaconda.ErrInvalidToken, anaconda.ErrSuspended}},
+		{429, `{"errors": [{"code": 88, "message": "Rate limit exceeded"}]}`, []error{anaconda.ErrRateLimited}},
+		{420, ``, []error{anaconda.ErrRateLimited}},
+		{503, `{"errors": [{"code": 130, "message": "Over capacity"}]}`, []error{anaconda.ErrOverCapacity, anaconda.ErrServiceUnavailable}},
+		{503, `<html><body>Over capacity</body></html>`, []error{anaconda.ErrServiceUnavailable}},
+	} {
+		status, body = c.status, c.body
+		_, err := api.GetTweet(1, nil)
+		apiErr, _ := err.(*anaconda.ApiError)
+		for _, sentinel := range c.expected {
+			if !errors.Is(err, sentinel) {
+				t.Errorf("Expected %v to match %v", err, sentinel)
+			}
+			// without following Unwrap, which older versions of Go ignore
+			if apiErr == nil || !apiErr.Is(sentinel) {
+				t.Errorf("Expected ApiError.Is to match %v for %v", sentinel, err)
+			}
+		}
+		if errors.Is(err, anaconda.ErrCouldNotAuthenticate) {
+			t.Errorf("Expected %v not to match %v", err, anaconda.ErrCouldNotAuthenticate)
+		}
+		// a 503 without code 130 may have been processed
+		if errors.Is(err, anaconda.ErrOverCapacity) && !apiErr.Decoded.Is(anaconda.ErrOverCapacity) {
+			t.Errorf("Expected %v not to match %v without code 130", err, anaconda.ErrOverCapacity)
+		}
+		var terr anaconda.TwitterError
+		if c.body != "" && c.body[0] == '{' && (!errors.As(err, &terr) || terr.Code == 0) {
+			t.Errorf("Expected %v to unwrap to its TwitterError", err)
+		}
+	}
+
+	// the HTML page of the last error is not in its message
+	_, err := api.GetTweet(1, nil)
+	if msg := err.Error(); strings.Contains(msg, "<html>") || !strings.Contains(msg, "Service Unavailable") {
+		t.Errorf("Unexpected message %q", msg)
+	}
+	var apiErr *anaconda.ApiError
+	if !errors.As(err, &apiErr) || apiErr.Decoded.First() != nil || apiErr.Decoded.Error() == "" {
+		t.Errorf("Expected no decoded error, got %#v", apiErr.Decoded)
+	}
+
+	if !errors.Is(anaconda.ErrWHSubscriptionNotFound, anaconda.ErrNotFound) {
+		t.Errorf("Expected %v to match %v", anaconda.ErrWHSubscriptionNotFound, anaconda.ErrNotFound)
+	}
+}
+
+func Test_ApiError_Body(t *testing.T) {
+	const body = `{"errors": [{"code": 187, "message": "Status is a duplicate."}]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Rate-Limit-Limit", "300")
+		w.Header().Set("X-Rate-Limit-Remaining", "299")
+		w.Header().Set("X-Rate-Limit-Reset", "1600000000")
+		switch r.URL.Query().Get("encoding") {
+		case "gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.WriteHeader(http.StatusForbidden)
+			zw := gzip.NewWriter(w)
+			zw.Write([]byte(body))
+			zw.Close()
+		case "deflate":
+			w.Header().Set("Content-Encoding", "deflate")
+			w.WriteHeader(http.StatusForbidden)
+			zw := zlib.NewWriter(w)
+			zw.Write([]byte(body))
+			zw.Close()
+		case "huge":
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write(bytes.Repeat([]byte("x"), 1<<20))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(body))
+		}
+	}))
+	defer server.Close()
+
+	api := anaconda.NewTwitterApiWithOptions(
+		anaconda.WithConsumerCredentials("consumer", "consumersecret"),
+		anaconda.WithAccessCredentials("token", "secret"),
+		anaconda.WithBaseUrl(server.URL),
+		// keep the compressed bodies for anaconda to decode
+		anaconda.WithHttpClient(&http.Client{Transport: &http.Transport{DisableCompression: true}}),
+		anaconda.WithMaxErrorBodySize(1024),
+	)
+	defer api.Close()
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		_, err := api.GetTweet(1, url.Values{"encoding": {encoding}})
+		var apiErr *anaconda.ApiError
+		if !errors.As(err, &apiErr) || !errors.Is(err, anaconda.ErrDuplicateStatus) || apiErr.Body != body {
+			t.Errorf("Expected the %s body to be decoded, got %v", encoding, err)
+		}
+	}
+
+	_, err := api.GetTweet(1, url.Values{"encoding": {"huge"}})
+	var apiErr *anaconda.ApiError
+	if !errors.As(err, &apiErr) || len(apiErr.Body) != 1024 || !apiErr.BodyTruncated {
+		t.Fatalf("Expected the body to be truncated at 1024 bytes, got %d bytes", len(apiErr.Body))
+	}
+	if apiErr.RateLimit == nil || apiErr.RateLimit.Resource != "/statuses/show/:id" || apiErr.RateLimit.Remaining != 299 {
+		t.Errorf("Unexpected rate limit %+v", apiErr.RateLimit)
+	}
+
+	_, err = api.PostTweet("duplicate", nil)
+	if !errors.As(err, &apiErr) || !strings.HasPrefix(err.Error(), "POST ") || apiErr.Method != http.MethodPost {
+		t.Errorf("Expected the error of a POST, got %v", err)
+	}
+
+	resp := &http.Response{
+		StatusCode: http.StatusForbidden,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Request:    httptest.NewRequest(http.MethodDelete, "/statuses/destroy/1.json", nil),
+	}
+	if apiErr := anaconda.NewApiError(resp); apiErr.Decoded.First() == nil || apiErr.Method != http.MethodDelete {
+		t.Errorf("Expected NewApiError to decode the body, got %#v", apiErr)
+	}
+}
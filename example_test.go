@@ -9,7 +9,7 @@ import (
 
 // Initialize an client library for a given user.
 // This only needs to be done *once* per user
-func ExampleTwitterApi_InitializeClient() {
+func ExampleNewTwitterApiWithCredentials() {
 	api := anaconda.NewTwitterApiWithCredentials(ACCESS_TOKEN, ACCESS_TOKEN_SECRET, "your-consumer-key", "your-consumer-secret")
 	fmt.Println(*api.Credentials)
 }
@@ -28,7 +28,7 @@ func ExampleTwitterApi_GetSearch() {
 }
 
 // Throttling queries can easily be handled in the background, automatically
-func ExampleTwitterApi_Throttling() {
+func ExampleTwitterApi_EnableThrottling() {
 	api := anaconda.NewTwitterApi("your-access-token", "your-access-token-secret")
 	api.EnableThrottling(10*time.Second, 5)
 
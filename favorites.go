@@ -5,7 +5,6 @@ import (
 )
 
 func (a TwitterApi) GetFavorites(v url.Values) (favorites []Tweet, err error) {
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/favorites/list.json", v, &favorites, _GET, response_ch}
-	return favorites, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/favorites/list.json", v, &favorites, _GET)
+	return favorites, err
 }
@@ -0,0 +1,171 @@
+package anaconda
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Values of the filter_level parameter of a filter stream
+const (
+	FilterLevelNone   = "none"
+	FilterLevelLow    = "low"
+	FilterLevelMedium = "medium"
+)
+
+// FilterParams are the parameters of a filter stream, see PublicStreamFilterParams.
+// At least one of Track, Follow and Locations must be set.
+// https://developer.twitter.com/en/docs/tweets/filter-realtime/guides/basic-stream-parameters
+//
+//  p := anaconda.FilterParams{
+//      Track:     []string{"golang", "gopher"},
+//      Locations: []anaconda.BoundingBox{{anaconda.LatLong{37.7, -122.75}, anaconda.LatLong{37.8, -122.35}}},
+//  }
+//  stream, err := api.PublicStreamFilterParams(p)
+type FilterParams struct {
+	// Track are the phrases to track, a phrase matches a Tweet containing all its space separated words
+	Track []string
+
+	// Follow are the ids of the users whose Tweets are returned
+	Follow []int64
+
+	// Locations are the areas the geotagged Tweets returned come from
+	Locations []BoundingBox
+
+	// Language restricts the Tweets to the given BCP 47 language codes, such as "en"
+	Language []string
+
+	// FilterLevel is one of FilterLevelNone, FilterLevelLow or FilterLevelMedium, or empty for the default
+	FilterLevel string
+
+	// Delimited prefixes every message with its length in bytes
+	Delimited bool
+
+	// StallWarnings asks for a StallWarning when the client falls behind
+	StallWarnings bool
+}
+
+// Validate checks the parameters against the limits documented by Twitter
+func (p FilterParams) Validate() error {
+	if len(p.Track) == 0 && len(p.Follow) == 0 && len(p.Locations) == 0 {
+		return fmt.Errorf("anaconda: a filter stream needs at least one track, follow or locations predicate")
+	}
+	if err := validateTrack(p.Track); err != nil {
+		return err
+	}
+	if err := validateFollow(p.Follow); err != nil {
+		return err
+	}
+	if err := validateLocations(p.Locations); err != nil {
+		return err
+	}
+	for _, l := range p.Language {
+		if l == "" || strings.ContainsAny(l, ", ") {
+			return fmt.Errorf("anaconda: invalid language %q", l)
+		}
+	}
+	switch p.FilterLevel {
+	case "", FilterLevelNone, FilterLevelLow, FilterLevelMedium:
+	default:
+		return fmt.Errorf("anaconda: invalid filter_level %q, must be %q, %q or %q", p.FilterLevel, FilterLevelNone, FilterLevelLow, FilterLevelMedium)
+	}
+	return nil
+}
+
+// Values validates the parameters and encodes them for PublicStreamFilter
+func (p FilterParams) Values() (url.Values, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	v := url.Values{}
+	if len(p.Track) > 0 {
+		v.Set("track", strings.Join(p.Track, ","))
+	}
+	if len(p.Follow) > 0 {
+		v.Set("follow", strings.Join(formatIDs(p.Follow), ","))
+	}
+	if len(p.Locations) > 0 {
+		v.Set("locations", formatLocations(p.Locations))
+	}
+	if len(p.Language) > 0 {
+		v.Set("language", strings.Join(p.Language, ","))
+	}
+	if p.FilterLevel != "" {
+		v.Set("filter_level", p.FilterLevel)
+	}
+	if p.Delimited {
+		v.Set("delimited", "length")
+	}
+	if p.StallWarnings {
+		v.Set("stall_warnings", "true")
+	}
+	return v, nil
+}
+
+// PublicStreamFilterParams is PublicStreamFilter with typed parameters.
+// Invalid parameters are reported before connecting.
+func (a TwitterApi) PublicStreamFilterParams(p FilterParams) (stream *Stream, err error) {
+	v, err := p.Values()
+	if err != nil {
+		return nil, err
+	}
+	return a.PublicStreamFilter(v), nil
+}
+
+// Validate checks the coordinates of the box, and that its south-west corner
+// is south and west of its north-east corner
+func (b BoundingBox) Validate() error {
+	for _, p := range []LatLong{b.SouthWest, b.NorthEast} {
+		if p.Lat < -90 || p.Lat > 90 || p.Long < -180 || p.Long > 180 {
+			return fmt.Errorf("anaconda: invalid coordinates %+v in bounding box %s", p, b)
+		}
+	}
+	if b.SouthWest.Lat > b.NorthEast.Lat || b.SouthWest.Long > b.NorthEast.Long {
+		return fmt.Errorf("anaconda: bounding box %s must go from its south-west corner to its north-east corner", b)
+	}
+	return nil
+}
+
+func validateTrack(phrases []string) error {
+	if len(phrases) > FilterMaxTrack {
+		return fmt.Errorf("anaconda: cannot track %d phrases, the limit is %d", len(phrases), FilterMaxTrack)
+	}
+	for _, p := range phrases {
+		if p == "" || len(p) > FilterMaxTrackLength || strings.Contains(p, ",") {
+			return fmt.Errorf("anaconda: track phrase %q must have 1 to %d bytes and no comma", p, FilterMaxTrackLength)
+		}
+	}
+	return nil
+}
+
+func validateFollow(userIDs []int64) error {
+	if len(userIDs) > FilterMaxFollow {
+		return fmt.Errorf("anaconda: cannot follow %d users, the limit is %d", len(userIDs), FilterMaxFollow)
+	}
+	for _, id := range userIDs {
+		if id <= 0 {
+			return fmt.Errorf("anaconda: invalid user id %d to follow", id)
+		}
+	}
+	return nil
+}
+
+func validateLocations(boxes []BoundingBox) error {
+	if len(boxes) > FilterMaxLocations {
+		return fmt.Errorf("anaconda: cannot filter %d locations, the limit is %d", len(boxes), FilterMaxLocations)
+	}
+	for _, b := range boxes {
+		if err := b.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatLocations(boxes []BoundingBox) string {
+	s := make([]string, len(boxes))
+	for i, b := range boxes {
+		s[i] = b.String()
+	}
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,468 @@
+package anaconda
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits of the predicates of a filter stream, as documented by Twitter
+// https://developer.twitter.com/en/docs/tweets/filter-realtime/guides/basic-stream-parameters
+const (
+	FilterMaxTrack       = 400
+	FilterMaxTrackLength = 60
+	FilterMaxFollow      = 5000
+	FilterMaxLocations   = 25
+)
+
+// DefaultFilterStreamOverlap is how long a FilterStream keeps its previous connection open
+// once the connection with the new predicates is established
+const DefaultFilterStreamOverlap = 10 * time.Second
+
+// filterStreamSeen is the number of tweet ids a FilterStream remembers to drop duplicates
+const filterStreamSeen = 10000
+
+// LatLong is a point given by its latitude and longitude
+type LatLong struct {
+	Lat, Long float64
+}
+
+// BoundingBox is an area of the locations predicate of a filter stream
+type BoundingBox struct {
+	SouthWest, NorthEast LatLong
+}
+
+// String returns the box in the form of the locations parameter: longitude,latitude pairs, south-west first
+func (b BoundingBox) String() string {
+	f := func(x float64) string { return strconv.FormatFloat(x, 'f', -1, 64) }
+	return f(b.SouthWest.Long) + "," + f(b.SouthWest.Lat) + "," + f(b.NorthEast.Long) + "," + f(b.NorthEast.Lat)
+}
+
+// FilterStream is a filter stream whose track, follow and locations predicates
+// can change while it runs, see NewFilterStream.
+//
+// Twitter only takes the predicates into account when connecting, so every change
+// opens a new connection. The previous connection is closed once the new one
+// is established and the overlap window is over, so that no message is lost
+// in between; tweets received on both connections are sent only once in C.
+// Every change costs a connection and Twitter rate limits connections,
+// so changes should be batched in a single call where possible.
+//
+//  fs := api.NewFilterStream(nil)
+//  if err := fs.AddTrack("golang", "gopher"); err != nil {
+//      log.Fatal(err)
+//  }
+//  for m := range fs.C {
+//      ...
+//  }
+type FilterStream struct {
+	api TwitterApi
+	v   url.Values
+
+	// C receives the messages of the stream,
+	// the status events are only those of the current connection
+	C chan interface{}
+
+	mu        sync.Mutex
+	overlap   time.Duration
+	track     []string
+	follow    []string
+	locations []BoundingBox
+	current   *Stream
+	retiring  []*Stream
+	stopped   bool
+	err       error
+
+	// stops the retiring connections once the overlap window is over
+	retireTimer *time.Timer
+
+	// ids of the last tweets received, to drop the duplicates of overlapping connections
+	seen     map[string]struct{}
+	seenRing []string
+	seenNext int
+
+	forwarders sync.WaitGroup
+	done       chan struct{}
+}
+
+// NewFilterStream returns a filter stream without predicates, it connects once one is added.
+// v holds the other parameters of the stream, such as stall_warnings or filter_level.
+func (a TwitterApi) NewFilterStream(v url.Values) *FilterStream {
+	fs := &FilterStream{
+		api:      a,
+		v:        url.Values{},
+		C:        make(chan interface{}),
+		overlap:  DefaultFilterStreamOverlap,
+		seen:     make(map[string]struct{}),
+		seenRing: make([]string, filterStreamSeen),
+		done:     make(chan struct{}),
+	}
+	for key, values := range v {
+		switch key {
+		case "track", "follow", "locations":
+		default:
+			fs.v[key] = append([]string(nil), values...)
+		}
+	}
+	return fs
+}
+
+// SetOverlap sets how long the previous connection is kept open once the new one is established
+func (fs *FilterStream) SetOverlap(d time.Duration) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.overlap = d
+}
+
+// Track returns the tracked phrases
+func (fs *FilterStream) Track() []string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]string(nil), fs.track...)
+}
+
+// Follow returns the ids of the followed users
+func (fs *FilterStream) Follow() []string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]string(nil), fs.follow...)
+}
+
+// Locations returns the bounding boxes of the locations predicate
+func (fs *FilterStream) Locations() []BoundingBox {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]BoundingBox(nil), fs.locations...)
+}
+
+// AddTrack tracks the given phrases and reconnects.
+// Nothing changes if the phrases would exceed FilterMaxTrack or one is invalid, as for FilterParams.Validate.
+func (fs *FilterStream) AddTrack(phrases ...string) error {
+	return fs.update(func() error {
+		track := addStrings(fs.track, phrases)
+		if err := validateTrack(track); err != nil {
+			return err
+		}
+		fs.track = track
+		return nil
+	})
+}
+
+// RemoveTrack stops tracking the given phrases and reconnects
+func (fs *FilterStream) RemoveTrack(phrases ...string) error {
+	return fs.update(func() error {
+		fs.track = removeStrings(fs.track, phrases)
+		return nil
+	})
+}
+
+// AddFollow follows the users with the given ids and reconnects.
+// Nothing changes if the ids would exceed FilterMaxFollow or one is not a valid user id.
+func (fs *FilterStream) AddFollow(userIDs ...int64) error {
+	return fs.update(func() error {
+		if err := validateFollow(userIDs); err != nil {
+			return err
+		}
+		follow := addStrings(fs.follow, formatIDs(userIDs))
+		if len(follow) > FilterMaxFollow {
+			return fmt.Errorf("anaconda: cannot follow %d users, the limit is %d", len(follow), FilterMaxFollow)
+		}
+		fs.follow = follow
+		return nil
+	})
+}
+
+// RemoveFollow stops following the users with the given ids and reconnects
+func (fs *FilterStream) RemoveFollow(userIDs ...int64) error {
+	return fs.update(func() error {
+		fs.follow = removeStrings(fs.follow, formatIDs(userIDs))
+		return nil
+	})
+}
+
+// AddLocations adds the given boxes to the locations predicate and reconnects.
+// Nothing changes if the boxes would exceed FilterMaxLocations or one is invalid, see BoundingBox.Validate.
+func (fs *FilterStream) AddLocations(boxes ...BoundingBox) error {
+	return fs.update(func() error {
+		locations := append([]BoundingBox(nil), fs.locations...)
+		for _, b := range boxes {
+			if indexBox(locations, b) < 0 {
+				locations = append(locations, b)
+			}
+		}
+		if err := validateLocations(locations); err != nil {
+			return err
+		}
+		fs.locations = locations
+		return nil
+	})
+}
+
+// RemoveLocations removes the given boxes from the locations predicate and reconnects
+func (fs *FilterStream) RemoveLocations(boxes ...BoundingBox) error {
+	return fs.update(func() error {
+		var locations []BoundingBox
+		for _, b := range fs.locations {
+			if indexBox(boxes, b) < 0 {
+				locations = append(locations, b)
+			}
+		}
+		fs.locations = locations
+		return nil
+	})
+}
+
+// Stop closes every connection of the stream, C is closed once they are.
+// The stream stops by itself when its connection ends for good, see Err.
+func (fs *FilterStream) Stop() {
+	fs.mu.Lock()
+	if fs.stopped {
+		fs.mu.Unlock()
+		return
+	}
+	fs.stopped = true
+	if fs.err == nil {
+		fs.err = ErrStreamStopped
+	}
+	if fs.retireTimer != nil {
+		fs.retireTimer.Stop()
+		fs.retireTimer = nil
+	}
+	streams := append(fs.retiring, fs.current)
+	fs.retiring = nil
+	fs.mu.Unlock()
+
+	for _, s := range streams {
+		if s != nil {
+			s.Stop()
+		}
+	}
+	go func() {
+		fs.forwarders.Wait()
+		close(fs.C)
+		close(fs.done)
+	}()
+}
+
+// Done returns a channel closed once the stream is stopped and C is closed
+func (fs *FilterStream) Done() <-chan struct{} {
+	return fs.done
+}
+
+// Err tells why the stream ended: ErrStreamStopped after Stop,
+// or the reason its connection ended for good, see Stream.Err.
+// Err returns nil while the stream is running.
+func (fs *FilterStream) Err() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.err
+}
+
+// update applies change to the predicates and reconnects with them
+func (fs *FilterStream) update(change func() error) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.stopped {
+		return ErrStreamStopped
+	}
+	before := fs.values().Encode()
+	if err := change(); err != nil {
+		return err
+	}
+	if fs.current != nil && fs.values().Encode() == before {
+		return nil
+	}
+
+	if fs.current != nil {
+		fs.retiring = append(fs.retiring, fs.current)
+		fs.current = nil
+	}
+	if len(fs.track) == 0 && len(fs.follow) == 0 && len(fs.locations) == 0 {
+		// nothing to filter, Twitter would reject the connection
+		fs.retire()
+		return nil
+	}
+
+	s := fs.api.PublicStreamFilter(fs.values())
+	fs.current = s
+	fs.forwarders.Add(1)
+	go fs.forward(s)
+	return nil
+}
+
+// values returns the parameters of a connection with the current predicates
+func (fs *FilterStream) values() url.Values {
+	v := url.Values{}
+	for key, values := range fs.v {
+		v[key] = values
+	}
+	if len(fs.track) > 0 {
+		v.Set("track", strings.Join(fs.track, ","))
+	}
+	if len(fs.follow) > 0 {
+		v.Set("follow", strings.Join(fs.follow, ","))
+	}
+	if len(fs.locations) > 0 {
+		v.Set("locations", formatLocations(fs.locations))
+	}
+	return v
+}
+
+// forward sends the messages of s in C, dropping the tweets already sent
+// and the status events of the connections being replaced
+func (fs *FilterStream) forward(s *Stream) {
+	defer fs.forwarders.Done()
+	for m := range s.C {
+		switch m := m.(type) {
+		case Tweet:
+			if fs.alreadySeen(m.IdStr) {
+				continue
+			}
+		case StreamStatusEvent:
+			if !fs.isCurrent(s, m) {
+				continue
+			}
+		}
+		select {
+		case fs.C <- m:
+		case <-s.Done():
+		}
+	}
+
+	// the current connection ended for good, for example with a 401
+	fs.mu.Lock()
+	failed := s == fs.current && s.Err() != ErrStreamStopped
+	if failed {
+		fs.err = s.Err()
+	}
+	fs.mu.Unlock()
+	if failed {
+		fs.Stop()
+	}
+}
+
+// isCurrent reports whether s is the current connection,
+// and retires the previous ones after the overlap window once s is connected
+func (fs *FilterStream) isCurrent(s *Stream, e StreamStatusEvent) bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if s != fs.current {
+		return false
+	}
+	if e.Status == StreamConnected && len(fs.retiring) > 0 {
+		// The retiring connections stay tracked until the timer stops them, so that Stop stops them too.
+		// A pending timer is replaced, its connections are part of the new batch.
+		if fs.retireTimer != nil {
+			fs.retireTimer.Stop()
+		}
+		retiring := append([]*Stream(nil), fs.retiring...)
+		var timer *time.Timer
+		timer = time.AfterFunc(fs.overlap, func() {
+			fs.mu.Lock()
+			if fs.retireTimer == timer {
+				fs.retireTimer = nil
+			}
+			fs.retiring = withoutStreams(fs.retiring, retiring)
+			fs.mu.Unlock()
+			for _, r := range retiring {
+				r.Stop()
+			}
+		})
+		fs.retireTimer = timer
+	}
+	return true
+}
+
+// retire stops the connections being replaced right away
+func (fs *FilterStream) retire() {
+	if fs.retireTimer != nil {
+		fs.retireTimer.Stop()
+		fs.retireTimer = nil
+	}
+	for _, r := range fs.retiring {
+		r.Stop()
+	}
+	fs.retiring = nil
+}
+
+// withoutStreams returns streams without the ones of removed
+func withoutStreams(streams, removed []*Stream) []*Stream {
+	kept := streams[:0]
+	for _, s := range streams {
+		found := false
+		for _, r := range removed {
+			if s == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+// alreadySeen reports whether the tweet with the given id was already sent,
+// and remembers it otherwise
+func (fs *FilterStream) alreadySeen(id string) bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, ok := fs.seen[id]; ok {
+		return true
+	}
+	delete(fs.seen, fs.seenRing[fs.seenNext])
+	fs.seenRing[fs.seenNext] = id
+	fs.seenNext = (fs.seenNext + 1) % len(fs.seenRing)
+	fs.seen[id] = struct{}{}
+	return false
+}
+
+func addStrings(list, add []string) []string {
+	result := append([]string(nil), list...)
+	for _, s := range add {
+		if indexString(result, s) < 0 {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func removeStrings(list, remove []string) []string {
+	var result []string
+	for _, s := range list {
+		if indexString(remove, s) < 0 {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func indexString(list []string, s string) int {
+	for i, x := range list {
+		if x == s {
+			return i
+		}
+	}
+	return -1
+}
+
+func indexBox(list []BoundingBox, b BoundingBox) int {
+	for i, x := range list {
+		if x == b {
+			return i
+		}
+	}
+	return -1
+}
+
+func formatIDs(ids []int64) []string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.FormatInt(id, 10)
+	}
+	return s
+}
@@ -0,0 +1,253 @@
+package anaconda_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ChimeraCoder/anaconda"
+)
+
+func Test_FilterStream(t *testing.T) {
+	var mu sync.Mutex
+	var tracks []string
+	closed := make(chan string, 2)
+
+	// streamTracked writes the given tweets, then waits for the client to hang up
+	streamTracked := func(ids ...string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			mu.Lock()
+			tracks = append(tracks, r.PostForm.Get("track"))
+			mu.Unlock()
+			for _, id := range ids {
+				fmt.Fprintf(w, `{"id_str": "%s", "text": "hello"}`+"\r\n", id)
+			}
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			closed <- r.PostForm.Get("track")
+		}
+	}
+	api, connections := newFakeStream(t, []http.HandlerFunc{
+		streamTracked("1", "2"),
+		streamTracked("2", "3"),
+	})
+
+	fs := api.NewFilterStream(nil)
+	fs.SetOverlap(50 * time.Millisecond)
+	if err := fs.AddTrack("golang"); err != nil {
+		t.Fatal(err)
+	}
+
+	tweets := map[string]int{}
+	read := func(n int) {
+		for len(tweets) < n {
+			select {
+			case m := <-fs.C:
+				if tweet, ok := m.(anaconda.Tweet); ok {
+					tweets[tweet.IdStr]++
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Timed out waiting for tweets, received %v", tweets)
+			}
+		}
+	}
+	read(2)
+
+	if err := fs.AddTrack("gopher", "golang"); err != nil {
+		t.Fatal(err)
+	}
+	read(3)
+
+	select {
+	case track := <-closed:
+		if track != "golang" {
+			t.Fatalf("Expected the first connection to be closed, closed %q", track)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The first connection was not closed after the overlap window")
+	}
+
+	fs.Stop()
+	for m := range fs.C {
+		if tweet, ok := m.(anaconda.Tweet); ok {
+			tweets[tweet.IdStr]++
+		}
+	}
+	<-fs.Done()
+	if fs.Err() != anaconda.ErrStreamStopped {
+		t.Errorf("Expected ErrStreamStopped, received %v", fs.Err())
+	}
+
+	for id, n := range tweets {
+		if n != 1 {
+			t.Errorf("Tweet %s received %d times", id, n)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(tracks) != 2 || tracks[0] != "golang" || tracks[1] != "golang,gopher" || connections() != 2 {
+		t.Fatalf("Unexpected connections %q", tracks)
+	}
+}
+
+// Test that Stop closes the connections being replaced during the overlap window
+func Test_FilterStream_StopDuringOverlap(t *testing.T) {
+	closed := make(chan string, 2)
+	streamTracked := func(id string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			fmt.Fprintf(w, `{"id_str": "%s", "text": "hello"}`+"\r\n", id)
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			closed <- r.PostForm.Get("track")
+		}
+	}
+	api, _ := newFakeStream(t, []http.HandlerFunc{streamTracked("1"), streamTracked("2")})
+
+	fs := api.NewFilterStream(nil)
+	fs.SetOverlap(time.Hour)
+	read := func(id string) {
+		for {
+			select {
+			case m := <-fs.C:
+				if tweet, ok := m.(anaconda.Tweet); ok && tweet.IdStr == id {
+					return
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Timed out waiting for tweet %s", id)
+			}
+		}
+	}
+	if err := fs.AddTrack("golang"); err != nil {
+		t.Fatal(err)
+	}
+	read("1")
+	if err := fs.AddTrack("gopher"); err != nil {
+		t.Fatal(err)
+	}
+	read("2")
+
+	fs.Stop()
+	go func() {
+		for range fs.C {
+		}
+	}()
+	select {
+	case <-fs.Done():
+	case <-time.After(time.Second):
+		t.Fatal("The stream did not end after Stop during the overlap window")
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-closed:
+		case <-time.After(time.Second):
+			t.Fatal("A connection was left open by Stop during the overlap window")
+		}
+	}
+}
+
+func Test_FilterStream_Limits(t *testing.T) {
+	api, connections := newFakeStream(t, nil)
+	fs := api.NewFilterStream(nil)
+	defer fs.Stop()
+
+	phrases := make([]string, anaconda.FilterMaxTrack+1)
+	for i := range phrases {
+		phrases[i] = fmt.Sprintf("phrase%d", i)
+	}
+	if err := fs.AddTrack(phrases...); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("Expected an error for %d phrases, received %v", len(phrases), err)
+	}
+	if err := fs.AddTrack(strings.Repeat("a", anaconda.FilterMaxTrackLength+1)); err == nil {
+		t.Errorf("Expected an error for a phrase too long")
+	}
+	if err := fs.AddTrack("go,lang"); err == nil {
+		t.Errorf("Expected an error for a phrase with a comma")
+	}
+	if err := fs.AddFollow(12, 0); err == nil {
+		t.Errorf("Expected an error for the user id 0")
+	}
+	if err := fs.AddFollow(-3); err == nil {
+		t.Errorf("Expected an error for a negative user id")
+	}
+
+	ids := make([]int64, anaconda.FilterMaxFollow+1)
+	for i := range ids {
+		ids[i] = int64(i + 1)
+	}
+	if err := fs.AddFollow(ids...); err == nil || !strings.Contains(err.Error(), "5000") {
+		t.Errorf("Expected an error for %d users, received %v", len(ids), err)
+	}
+
+	boxes := make([]anaconda.BoundingBox, anaconda.FilterMaxLocations+1)
+	for i := range boxes {
+		boxes[i] = anaconda.BoundingBox{anaconda.LatLong{float64(i), 0}, anaconda.LatLong{float64(i) + 1, 1}}
+	}
+	if err := fs.AddLocations(boxes...); err == nil || !strings.Contains(err.Error(), "25") {
+		t.Errorf("Expected an error for %d boxes, received %v", len(boxes), err)
+	}
+
+	if len(fs.Track()) != 0 || len(fs.Follow()) != 0 || len(fs.Locations()) != 0 || connections() != 0 {
+		t.Fatalf("Invalid predicates were applied")
+	}
+}
+
+func Test_FilterParams(t *testing.T) {
+	p := anaconda.FilterParams{
+		Track:         []string{"golang", "go gopher"},
+		Follow:        []int64{12, 783214},
+		Locations:     []anaconda.BoundingBox{{anaconda.LatLong{37.7, -122.75}, anaconda.LatLong{37.8, -122.35}}},
+		Language:      []string{"en", "fr"},
+		FilterLevel:   anaconda.FilterLevelLow,
+		Delimited:     true,
+		StallWarnings: true,
+	}
+	v, err := p.Values()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := url.Values{
+		"track":          {"golang,go gopher"},
+		"follow":         {"12,783214"},
+		"locations":      {"-122.75,37.7,-122.35,37.8"},
+		"language":       {"en,fr"},
+		"filter_level":   {"low"},
+		"delimited":      {"length"},
+		"stall_warnings": {"true"},
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("Expected %v, received %v", expected, v)
+	}
+
+	sf := anaconda.LatLong{37.7, -122.75}
+	ny := anaconda.LatLong{40.8, -73.9}
+	invalid := map[string]anaconda.FilterParams{
+		"no predicate":      {Language: []string{"en"}},
+		"empty phrase":      {Track: []string{""}},
+		"comma":             {Track: []string{"a,b"}},
+		"invalid user":      {Follow: []int64{0}},
+		"north-east first":  {Locations: []anaconda.BoundingBox{{ny, sf}}},
+		"east then west":    {Locations: []anaconda.BoundingBox{{anaconda.LatLong{37, 10}, anaconda.LatLong{38, 9}}}},
+		"latitude too high": {Locations: []anaconda.BoundingBox{{sf, anaconda.LatLong{91, 0}}}},
+		"filter level":      {Track: []string{"golang"}, FilterLevel: "high"},
+	}
+	for name, p := range invalid {
+		if _, err := p.Values(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	api, connections := newFakeStream(t, nil)
+	if s, err := api.PublicStreamFilterParams(invalid["north-east first"]); err == nil || s != nil {
+		t.Errorf("Expected an error and no stream, received %v", err)
+	}
+	if connections() != 0 {
+		t.Errorf("Invalid parameters opened a connection")
+	}
+}
@@ -64,13 +64,12 @@ type FollowersIdsPage struct {
 // GetFriendshipsNoRetweets returns a collection of user_ids that the currently authenticated user does not want to receive retweets from.
 // It does not currently support the stringify_ids parameter.
 func (a TwitterApi) GetFriendshipsNoRetweets() (ids []int64, err error) {
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/friendships/no_retweets/ids.json", nil, &ids, _GET, response_ch}
-	return ids, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/friendships/no_retweets/ids.json", nil, &ids, _GET)
+	return ids, err
 }
 
 func (a TwitterApi) GetFollowersIds(v url.Values) (c Cursor, err error) {
-	err = a.apiGet(a.baseUrl+"/followers/ids.json", v, &c)
+	err = a.sendQuery(a.baseUrl+"/followers/ids.json", v, &c, _GET)
 	return
 }
 
@@ -103,39 +102,33 @@ func (a TwitterApi) GetFollowersIdsAll(v url.Values) (result chan FollowersIdsPa
 }
 
 func (a TwitterApi) GetFriendsIds(v url.Values) (c Cursor, err error) {
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/friends/ids.json", v, &c, _GET, response_ch}
-	return c, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/friends/ids.json", v, &c, _GET)
+	return c, err
 }
 
 func (a TwitterApi) GetFriendshipsLookup(v url.Values) (friendships []Friendship, err error) {
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/friendships/lookup.json", v, &friendships, _GET, response_ch}
-	return friendships, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/friendships/lookup.json", v, &friendships, _GET)
+	return friendships, err
 }
 
 func (a TwitterApi) GetFriendshipsIncoming(v url.Values) (c Cursor, err error) {
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/friendships/incoming.json", v, &c, _GET, response_ch}
-	return c, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/friendships/incoming.json", v, &c, _GET)
+	return c, err
 }
 
 func (a TwitterApi) GetFriendshipsOutgoing(v url.Values) (c Cursor, err error) {
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/friendships/outgoing.json", v, &c, _GET, response_ch}
-	return c, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/friendships/outgoing.json", v, &c, _GET)
+	return c, err
 }
 
 func (a TwitterApi) GetFollowersList(v url.Values) (c UserCursor, err error) {
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/followers/list.json", v, &c, _GET, response_ch}
-	return c, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/followers/list.json", v, &c, _GET)
+	return c, err
 }
 
 func (a TwitterApi) GetFriendsList(v url.Values) (c UserCursor, err error) {
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/friends/list.json", v, &c, _GET, response_ch}
-	return c, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/friends/list.json", v, &c, _GET)
+	return c, err
 }
 
 // Like GetFriendsList, but returns a channel instead of a cursor and pre-fetches the remaining results
@@ -200,17 +193,15 @@ func (a TwitterApi) GetListMembers(screenName string, listID int64, v url.Values
 	v.Set("list_id", strconv.FormatInt(listID, 10))
 	v.Set("screen_name", screenName)
 
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/lists/members.json", v, &c, _GET, response_ch}
-	return c, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/lists/members.json", v, &c, _GET)
+	return c, err
 }
 
 func (a TwitterApi) GetFollowersUser(id int64, v url.Values) (c Cursor, err error) {
 	v = cleanValues(v)
 	v.Set("user_id", strconv.FormatInt(id, 10))
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/followers/ids.json", v, &c, _GET, response_ch}
-	return c, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/followers/ids.json", v, &c, _GET)
+	return c, err
 }
 
 // Like GetFriendsIds, but returns a channel instead of a cursor and pre-fetches the remaining results
@@ -244,9 +235,8 @@ func (a TwitterApi) GetFriendsIdsAll(v url.Values) (result chan FriendsIdsPage)
 func (a TwitterApi) GetFriendsUser(id int64, v url.Values) (c Cursor, err error) {
 	v = cleanValues(v)
 	v.Set("user_id", strconv.FormatInt(id, 10))
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/friends/ids.json", v, &c, _GET, response_ch}
-	return c, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/friends/ids.json", v, &c, _GET)
+	return c, err
 }
 
 // FollowUserId follows the user with the specified userId.
@@ -268,9 +258,8 @@ func (a TwitterApi) FollowUser(screenName string) (user User, err error) {
 }
 
 func (a TwitterApi) postFriendshipsCreateImpl(v url.Values) (user User, err error) {
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/friendships/create.json", v, &user, _POST, response_ch}
-	return user, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/friendships/create.json", v, &user, _POST)
+	return user, err
 }
 
 // UnfollowUserId unfollows the user with the specified userId.
@@ -281,9 +270,8 @@ func (a TwitterApi) UnfollowUserId(userId int64) (u User, err error) {
 	v.Set("user_id", strconv.FormatInt(userId, 10))
 	// Set other values before calling this method:
 	// page, count, include_entities
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/friendships/destroy.json", v, &u, _POST, response_ch}
-	return u, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/friendships/destroy.json", v, &u, _POST)
+	return u, err
 }
 
 // UnfollowUser unfollows the user with the specified screenname (username)
@@ -294,7 +282,6 @@ func (a TwitterApi) UnfollowUser(screenname string) (u User, err error) {
 	v.Set("screen_name", screenname)
 	// Set other values before calling this method:
 	// page, count, include_entities
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/friendships/destroy.json", v, &u, _POST, response_ch}
-	return u, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/friendships/destroy.json", v, &u, _POST)
+	return u, err
 }
@@ -12,9 +12,8 @@ func (a TwitterApi) CreateList(name, description string, v url.Values) (list Lis
 	v.Set("name", name)
 	v.Set("description", description)
 
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/lists/create.json", v, &list, _POST, response_ch}
-	return list, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/lists/create.json", v, &list, _POST)
+	return list, err
 }
 
 // AddUserToList implements /lists/members/create.json
@@ -25,9 +24,8 @@ func (a TwitterApi) AddUserToList(screenName string, listID int64, v url.Values)
 
 	var addUserToListResponse AddUserToListResponse
 
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/lists/members/create.json", v, &addUserToListResponse, _POST, response_ch}
-	return addUserToListResponse.Users, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/lists/members/create.json", v, &addUserToListResponse, _POST)
+	return addUserToListResponse.Users, err
 }
 
 // AddMultipleUsersToList implements /lists/members/create_all.json
@@ -36,10 +34,8 @@ func (a TwitterApi) AddMultipleUsersToList(screenNames []string, listID int64, v
 	v.Set("list_id", strconv.FormatInt(listID, 10))
 	v.Set("screen_name", strings.Join(screenNames, ","))
 
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/lists/members/create_all.json", v, &list, _POST, response_ch}
-	r := <-response_ch
-	return list, r.err
+	err = a.sendQuery(a.baseUrl+"/lists/members/create_all.json", v, &list, _POST)
+	return list, err
 }
 
 // GetListsOwnedBy implements /lists/ownerships.json
@@ -50,9 +46,8 @@ func (a TwitterApi) GetListsOwnedBy(userID int64, v url.Values) (lists []List, e
 
 	var listResponse ListResponse
 
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/lists/ownerships.json", v, &listResponse, _GET, response_ch}
-	return listResponse.Lists, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/lists/ownerships.json", v, &listResponse, _GET)
+	return listResponse.Lists, err
 }
 
 func (a TwitterApi) GetListTweets(listID int64, includeRTs bool, v url.Values) (tweets []Tweet, err error) {
@@ -60,9 +55,8 @@ func (a TwitterApi) GetListTweets(listID int64, includeRTs bool, v url.Values) (
 	v.Set("list_id", strconv.FormatInt(listID, 10))
 	v.Set("include_rts", strconv.FormatBool(includeRTs))
 
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/lists/statuses.json", v, &tweets, _GET, response_ch}
-	return tweets, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/lists/statuses.json", v, &tweets, _GET)
+	return tweets, err
 }
 
 // GetList implements /lists/show.json
@@ -70,9 +64,8 @@ func (a TwitterApi) GetList(listID int64, v url.Values) (list List, err error) {
 	v = cleanValues(v)
 	v.Set("list_id", strconv.FormatInt(listID, 10))
 
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/lists/show.json", v, &list, _GET, response_ch}
-	return list, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/lists/show.json", v, &list, _GET)
+	return list, err
 }
 
 func (a TwitterApi) GetListTweetsBySlug(slug string, ownerScreenName string, includeRTs bool, v url.Values) (tweets []Tweet, err error) {
@@ -81,7 +74,6 @@ func (a TwitterApi) GetListTweetsBySlug(slug string, ownerScreenName string, inc
 	v.Set("owner_screen_name", ownerScreenName)
 	v.Set("include_rts", strconv.FormatBool(includeRTs))
 
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/lists/statuses.json", v, &tweets, _GET, response_ch}
-	return tweets, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/lists/statuses.json", v, &tweets, _GET)
+	return tweets, err
 }
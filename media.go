@@ -42,9 +42,8 @@ func (a TwitterApi) UploadMedia(base64String string) (media Media, err error) {
 
 	var mediaResponse Media
 
-	response_ch := make(chan response)
-	a.queryQueue <- query{UploadBaseUrl + "/media/upload.json", v, &mediaResponse, _POST, response_ch}
-	return mediaResponse, (<-response_ch).err
+	err = a.sendQuery(a.uploadUrl()+"/media/upload.json", v, &mediaResponse, _POST)
+	return mediaResponse, err
 }
 
 func (a TwitterApi) UploadVideoInit(totalBytes int, mimeType string) (chunkedMedia ChunkedMedia, err error) {
@@ -55,9 +54,8 @@ func (a TwitterApi) UploadVideoInit(totalBytes int, mimeType string) (chunkedMed
 
 	var mediaResponse ChunkedMedia
 
-	response_ch := make(chan response)
-	a.queryQueue <- query{UploadBaseUrl + "/media/upload.json", v, &mediaResponse, _POST, response_ch}
-	return mediaResponse, (<-response_ch).err
+	err = a.sendQuery(a.uploadUrl()+"/media/upload.json", v, &mediaResponse, _POST)
+	return mediaResponse, err
 }
 
 func (a TwitterApi) UploadVideoAppend(mediaIdString string,
@@ -71,9 +69,7 @@ func (a TwitterApi) UploadVideoAppend(mediaIdString string,
 
 	var emptyResponse interface{}
 
-	response_ch := make(chan response)
-	a.queryQueue <- query{UploadBaseUrl + "/media/upload.json", v, &emptyResponse, _POST, response_ch}
-	return (<-response_ch).err
+	return a.sendQuery(a.uploadUrl()+"/media/upload.json", v, &emptyResponse, _POST)
 }
 
 func (a TwitterApi) UploadVideoFinalize(mediaIdString string) (videoMedia VideoMedia, err error) {
@@ -83,7 +79,14 @@ func (a TwitterApi) UploadVideoFinalize(mediaIdString string) (videoMedia VideoM
 
 	var mediaResponse VideoMedia
 
-	response_ch := make(chan response)
-	a.queryQueue <- query{UploadBaseUrl + "/media/upload.json", v, &mediaResponse, _POST, response_ch}
-	return mediaResponse, (<-response_ch).err
+	err = a.sendQuery(a.uploadUrl()+"/media/upload.json", v, &mediaResponse, _POST)
+	return mediaResponse, err
+}
+
+// uploadUrl returns the base URL of the media endpoints, see WithUploadBaseUrl
+func (a TwitterApi) uploadUrl() string {
+	if a.uploadBaseUrl != "" {
+		return a.uploadBaseUrl
+	}
+	return UploadBaseUrl
 }
@@ -0,0 +1,58 @@
+package anaconda
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// Request is a signed request to the REST API, as seen by the middlewares
+type Request struct {
+	*http.Request
+
+	// Endpoint is the path of the endpoint with its identifiers replaced, such as "/statuses/show/:id",
+	// the resource of its rate limit
+	Endpoint string
+
+	// Form holds the values of the query, nil for the JSON and multipart payloads
+	Form url.Values
+}
+
+// RedactedHeader returns a copy of the header of the request without its credentials, to be logged
+func (r *Request) RedactedHeader() http.Header {
+	h := r.Header.Clone()
+	if h.Get("Authorization") != "" {
+		h.Set("Authorization", "REDACTED")
+	}
+	return h
+}
+
+// RoundTripFunc sends a request and returns its response or, for a failed status, the response with its *ApiError.
+// The body of the response is closed along with an error.
+type RoundTripFunc func(r *Request) (*http.Response, error)
+
+// Middleware wraps the sending of the requests to the REST API, once they are signed, see Use
+type Middleware func(next RoundTripFunc) RoundTripFunc
+
+// Use adds middlewares around the sending of the requests to the REST API, to trace, log, measure or cache them.
+// The middlewares added first are the outermost. A middleware sees every attempt of a query,
+// while the retries, the throttling and the rate limits are handled around it.
+// The streams and the OAuth handshakes do not go through the middlewares.
+// Use must be called before the first query.
+//
+//  api.Use(func(next anaconda.RoundTripFunc) anaconda.RoundTripFunc {
+//      return func(r *anaconda.Request) (*http.Response, error) {
+//          start := time.Now()
+//          resp, err := next(r)
+//          var apiErr *anaconda.ApiError
+//          errors.As(err, &apiErr)
+//          log.Printf("%s %s in %s: %v", r.Method, r.Endpoint, time.Since(start), apiErr)
+//          return resp, err
+//      }
+//  })
+//
+// A middleware may answer without calling next, for instance from a cache,
+// with a response whose body is the JSON of the endpoint.
+func (c *TwitterApi) Use(middlewares ...Middleware) {
+	// never append to the array of the copies made by WithContext
+	c.middlewares = append(c.middlewares[:len(c.middlewares):len(c.middlewares)], middlewares...)
+}
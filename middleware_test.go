@@ -0,0 +1,103 @@
+package anaconda_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ChimeraCoder/anaconda"
+)
+
+func Test_TwitterApi_Middleware(t *testing.T) {
+	var mu sync.Mutex
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/statuses/show.json":
+			w.Write([]byte(`{"id": 1, "full_text": "cached"}`))
+		case "/statuses/update.json":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors": [{"code": 187, "message": "Status is a duplicate."}]}`))
+		default:
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+	}))
+	defer server.Close()
+
+	var calls []string
+	var seen []*anaconda.Request
+	var errs []error
+	logging := func(next anaconda.RoundTripFunc) anaconda.RoundTripFunc {
+		return func(r *anaconda.Request) (*http.Response, error) {
+			calls = append(calls, "logging")
+			if auth := r.RedactedHeader().Get("Authorization"); auth != "REDACTED" {
+				t.Errorf("Expected the authorization to be redacted, got %q", auth)
+			}
+			resp, err := next(r)
+			seen = append(seen, r)
+			errs = append(errs, err)
+			return resp, err
+		}
+	}
+	cache := map[string][]byte{}
+	caching := func(next anaconda.RoundTripFunc) anaconda.RoundTripFunc {
+		return func(r *anaconda.Request) (*http.Response, error) {
+			calls = append(calls, "caching")
+			if body, ok := cache[r.URL.String()]; ok && r.Method == http.MethodGet {
+				return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: ioutil.NopCloser(bytes.NewReader(body))}, nil
+			}
+			resp, err := next(r)
+			if err != nil {
+				return resp, err
+			}
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			cache[r.URL.String()] = body
+			resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+			return resp, nil
+		}
+	}
+
+	api := anaconda.NewTwitterApiWithOptions(
+		anaconda.WithConsumerCredentials("consumer", "consumersecret"),
+		anaconda.WithAccessCredentials("token", "secret"),
+		anaconda.WithBaseUrl(server.URL),
+		anaconda.WithMiddleware(logging),
+	)
+	api.Use(caching)
+	defer api.Close()
+
+	for i := 0; i < 2; i++ {
+		tweet, err := api.GetTweet(1, nil)
+		if err != nil || tweet.FullText != "cached" {
+			t.Fatalf("Unexpected tweet %+v, %v", tweet, err)
+		}
+	}
+	if hits != 1 {
+		t.Errorf("Expected the second query to be answered by the cache, got %d requests", hits)
+	}
+
+	if _, err := api.PostTweet("duplicate", nil); !errors.Is(err, anaconda.ErrDuplicateStatus) {
+		t.Errorf("Expected a duplicate status, got %v", err)
+	}
+
+	if strings.Join(calls, ",") != "logging,caching,logging,caching,logging,caching" {
+		t.Errorf("Unexpected order of the middlewares %v", calls)
+	}
+	if len(seen) != 3 || seen[0].Endpoint != "/statuses/show/:id" || seen[2].Endpoint != "/statuses/update" ||
+		seen[2].Method != http.MethodPost || seen[2].Form.Get("status") != "duplicate" {
+		t.Fatalf("Unexpected requests %+v", seen)
+	}
+	var apiErr *anaconda.ApiError
+	if errs[0] != nil || !errors.As(errs[2], &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+		t.Errorf("Unexpected errors %v", errs)
+	}
+}
@@ -6,15 +6,13 @@ import (
 )
 
 func (a TwitterApi) GetMutedUsersList(v url.Values) (c UserCursor, err error) {
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/mutes/users/list.json", v, &c, _GET, response_ch}
-	return c, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/mutes/users/list.json", v, &c, _GET)
+	return c, err
 }
 
 func (a TwitterApi) GetMutedUsersIds(v url.Values) (c Cursor, err error) {
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/mutes/users/ids.json", v, &c, _GET, response_ch}
-	return c, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/mutes/users/ids.json", v, &c, _GET)
+	return c, err
 }
 
 func (a TwitterApi) MuteUser(screenName string, v url.Values) (user User, err error) {
@@ -30,9 +28,8 @@ func (a TwitterApi) MuteUserId(id int64, v url.Values) (user User, err error) {
 }
 
 func (a TwitterApi) Mute(v url.Values) (user User, err error) {
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/mutes/users/create.json", v, &user, _POST, response_ch}
-	return user, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/mutes/users/create.json", v, &user, _POST)
+	return user, err
 }
 
 func (a TwitterApi) UnmuteUser(screenName string, v url.Values) (user User, err error) {
@@ -48,7 +45,6 @@ func (a TwitterApi) UnmuteUserId(id int64, v url.Values) (user User, err error)
 }
 
 func (a TwitterApi) Unmute(v url.Values) (user User, err error) {
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/mutes/users/destroy.json", v, &user, _POST, response_ch}
-	return user, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/mutes/users/destroy.json", v, &user, _POST)
+	return user, err
 }
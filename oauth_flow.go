@@ -0,0 +1,318 @@
+package anaconda
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/garyburd/go-oauth/oauth"
+)
+
+// OAuthCallbackOOB is the callback of the PIN-based flow: instead of redirecting the user,
+// Twitter displays the verifier, a PIN, for the user to enter in the application
+const OAuthCallbackOOB = "oob"
+
+// Values of AuthorizeOptions.AccessType
+const (
+	AccessTypeRead  = "read"
+	AccessTypeWrite = "write"
+)
+
+var (
+	// ErrOAuthDenied is returned by the callback of a user who declined to authorize the app
+	ErrOAuthDenied = errors.New("anaconda: the user denied the authorization")
+
+	// ErrUnknownTempCredentials is returned by the callback of a request token missing from the store,
+	// expired or already used
+	ErrUnknownTempCredentials = errors.New("anaconda: unknown or expired request token")
+)
+
+// AuthorizeOptions are the optional parameters of the authorization step of the OAuth flow
+// https://developer.twitter.com/en/docs/basics/authentication/api-reference/authenticate
+type AuthorizeOptions struct {
+	// ForceLogin asks the user to sign in even when a Twitter session is open
+	ForceLogin bool
+
+	// ScreenName prefills the screen name of the sign in form
+	ScreenName string
+
+	// AccessType, AccessTypeRead or AccessTypeWrite, restricts the access of the token
+	// below the permissions of the app. Empty means the permissions of the app.
+	AccessType string
+
+	// Authorize sends the user to oauth/authorize, which asks for the authorization every time,
+	// instead of oauth/authenticate (Sign in with Twitter), which redirects the users who already
+	// authorized the app right away
+	Authorize bool
+}
+
+// OAuthResult is the outcome of a completed OAuth flow: the access token of the user who authorized the app
+type OAuthResult struct {
+	UserID      string
+	ScreenName  string
+	Credentials *oauth.Credentials
+}
+
+//AuthorizationURL generates the authorization URL for the first part of the OAuth handshake.
+//Redirect the user to this URL.
+//This assumes that the consumer key has already been set (using SetConsumerKey or NewTwitterApiWithCredentials).
+func (c *TwitterApi) AuthorizationURL(callback string) (string, *oauth.Credentials, error) {
+	return c.AuthorizationURLWithOptions(callback, AuthorizeOptions{})
+}
+
+//AuthorizationURLWithOptions is AuthorizationURL with the optional parameters of the authorization step.
+//Use OAuthCallbackOOB as callback for the PIN-based flow, see PINAuthorizationURL.
+//https://developer.twitter.com/en/docs/basics/authentication/api-reference/request_token
+func (c *TwitterApi) AuthorizationURLWithOptions(callback string, opts AuthorizeOptions) (string, *oauth.Credentials, error) {
+	switch opts.AccessType {
+	case "", AccessTypeRead, AccessTypeWrite:
+	default:
+		return "", nil, fmt.Errorf("anaconda: invalid x_auth_access_type %q", opts.AccessType)
+	}
+	var params url.Values
+	if opts.AccessType != "" {
+		params = url.Values{"x_auth_access_type": {opts.AccessType}}
+	}
+	client := c.oauthFlowClient(opts.Authorize)
+	tempCred, err := client.RequestTemporaryCredentials(c.oauthHttpClient(), callback, params)
+	if err != nil {
+		return "", nil, err
+	}
+
+	v := url.Values{}
+	if opts.ForceLogin {
+		v.Set("force_login", "true")
+	}
+	if opts.ScreenName != "" {
+		v.Set("screen_name", opts.ScreenName)
+	}
+	return client.AuthorizationURL(tempCred, v), tempCred, nil
+}
+
+//PINAuthorizationURL starts the PIN-based flow, for the applications which cannot receive a callback:
+//the user visits the URL, authorizes the app and enters the displayed PIN in the application,
+//which passes it as verifier to CompleteAuthorization.
+//https://developer.twitter.com/en/docs/basics/authentication/overview/pin-based-oauth
+func (c *TwitterApi) PINAuthorizationURL(opts AuthorizeOptions) (string, *oauth.Credentials, error) {
+	opts.Authorize = true
+	return c.AuthorizationURLWithOptions(OAuthCallbackOOB, opts)
+}
+
+// GetCredentials gets the access token using the verifier received with the callback URL and the
+// credentials in the first part of the handshake. GetCredentials implements the third part of the OAuth handshake.
+// The returned url.Values holds the access_token, the access_token_secret, the user_id and the screen_name.
+func (c *TwitterApi) GetCredentials(tempCred *oauth.Credentials, verifier string) (*oauth.Credentials, url.Values, error) {
+	return c.oauthFlowClient(false).RequestToken(c.oauthHttpClient(), tempCred, verifier)
+}
+
+// CompleteAuthorization is GetCredentials returning a typed result.
+// verifier is the oauth_verifier of the callback, or the PIN of the PIN-based flow.
+// https://developer.twitter.com/en/docs/basics/authentication/api-reference/access_token
+func (c *TwitterApi) CompleteAuthorization(tempCred *oauth.Credentials, verifier string) (*OAuthResult, error) {
+	cred, v, err := c.GetCredentials(tempCred, verifier)
+	if err != nil {
+		return nil, err
+	}
+	return &OAuthResult{
+		UserID:      v.Get("user_id"),
+		ScreenName:  v.Get("screen_name"),
+		Credentials: cred,
+	}, nil
+}
+
+// oauthFlowClient returns the OAuth client with the URLs of the OAuth endpoints at the root of the base URL
+func (c *TwitterApi) oauthFlowClient(authorize bool) *oauth.Client {
+	client := c.oauthClient
+	root := c.oauthBaseUrl()
+	client.TemporaryCredentialRequestURI = root + "/oauth/request_token"
+	client.ResourceOwnerAuthorizationURI = root + "/oauth/authenticate"
+	if authorize {
+		client.ResourceOwnerAuthorizationURI = root + "/oauth/authorize"
+	}
+	client.TokenRequestURI = root + "/oauth/access_token"
+	return &client
+}
+
+// oauthHttpClient returns the HTTP client of the API, whose requests are bound to the context of the API
+func (c *TwitterApi) oauthHttpClient() *http.Client {
+	client := *c.httpClient()
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client.Transport = contextTransport{c.Context(), base}
+	return &client
+}
+
+// contextTransport binds the requests of a library without contexts to ctx
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(req.WithContext(t.ctx))
+}
+
+// TempCredentialStore keeps the temporary credentials of the OAuth flows in progress,
+// between the redirect and the callback of SignInHandlers
+type TempCredentialStore interface {
+	// Save stores cred, keyed by its token
+	Save(cred *oauth.Credentials) error
+
+	// Take returns and removes the credentials of token, or ErrUnknownTempCredentials
+	Take(token string) (*oauth.Credentials, error)
+}
+
+// MemoryTempCredentialStore is a TempCredentialStore in memory, for a single process.
+// Credentials expire after the TTL.
+type MemoryTempCredentialStore struct {
+	ttl   time.Duration
+	mu    sync.Mutex
+	creds map[string]memoryTempCredential
+}
+
+type memoryTempCredential struct {
+	cred    *oauth.Credentials
+	expires time.Time
+}
+
+// NewMemoryTempCredentialStore returns a store whose credentials expire after ttl
+func NewMemoryTempCredentialStore(ttl time.Duration) *MemoryTempCredentialStore {
+	return &MemoryTempCredentialStore{ttl: ttl, creds: make(map[string]memoryTempCredential)}
+}
+
+func (s *MemoryTempCredentialStore) Save(cred *oauth.Credentials) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for token, c := range s.creds {
+		if now.After(c.expires) {
+			delete(s.creds, token)
+		}
+	}
+	s.creds[cred.Token] = memoryTempCredential{cred, now.Add(s.ttl)}
+	return nil
+}
+
+func (s *MemoryTempCredentialStore) Take(token string) (*oauth.Credentials, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.creds[token]
+	delete(s.creds, token)
+	if !ok || time.Now().After(c.expires) {
+		return nil, ErrUnknownTempCredentials
+	}
+	return c.cred, nil
+}
+
+// SignInHandlers are the two steps of the three-legged OAuth flow as http.Handlers:
+// Redirect sends the user to Twitter, which sends the user back to Callback.
+// The temporary credentials are kept in Store in between.
+//
+//  h := anaconda.NewSignInHandlers(api, "https://example.com/twitter/callback")
+//  h.OnSuccess = func(w http.ResponseWriter, r *http.Request, res *anaconda.OAuthResult) {
+//      // store res.Credentials for res.UserID, start a session
+//  }
+//  http.Handle("/twitter/signin", h.Redirect())
+//  http.Handle("/twitter/callback", h.Callback())
+type SignInHandlers struct {
+	api *TwitterApi
+
+	CallbackURL string
+	Options     AuthorizeOptions
+	Store       TempCredentialStore
+
+	// Log receives the failed flows
+	// Default logger is silent
+	Log Logger
+
+	// OnSuccess answers the callback of a completed flow, it answers 200 OK when not set
+	OnSuccess func(w http.ResponseWriter, r *http.Request, res *OAuthResult)
+
+	// OnError answers the redirect or the callback of a failed flow,
+	// it answers 403 Forbidden for ErrOAuthDenied, 400 Bad Request for ErrUnknownTempCredentials
+	// and 502 Bad Gateway for the other errors when not set
+	OnError func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// NewSignInHandlers returns the handlers of the OAuth flow of the app of api, whose consumer credentials must be set.
+// Temporary credentials are kept in memory for 15 minutes.
+func NewSignInHandlers(api *TwitterApi, callbackURL string) *SignInHandlers {
+	return &SignInHandlers{
+		api:         api,
+		CallbackURL: callbackURL,
+		Store:       NewMemoryTempCredentialStore(15 * time.Minute),
+		Log:         silentLogger{},
+	}
+}
+
+// Redirect requests temporary credentials and redirects the user to the authorization URL
+func (h *SignInHandlers) Redirect() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authURL, tempCred, err := h.api.WithContext(r.Context()).AuthorizationURLWithOptions(h.CallbackURL, h.Options)
+		if err == nil {
+			err = h.Store.Save(tempCred)
+		}
+		if err != nil {
+			h.fail(w, r, err)
+			return
+		}
+		http.Redirect(w, r, authURL, http.StatusFound)
+	})
+}
+
+// Callback exchanges the temporary credentials and the verifier of the callback for the access token of the user
+func (h *SignInHandlers) Callback() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if denied := q.Get("denied"); denied != "" {
+			// the request token is of no use anymore
+			h.Store.Take(denied)
+			h.fail(w, r, ErrOAuthDenied)
+			return
+		}
+		tempCred, err := h.Store.Take(q.Get("oauth_token"))
+		if err != nil {
+			h.fail(w, r, err)
+			return
+		}
+		res, err := h.api.WithContext(r.Context()).CompleteAuthorization(tempCred, q.Get("oauth_verifier"))
+		if err != nil {
+			h.fail(w, r, err)
+			return
+		}
+		if h.OnSuccess != nil {
+			h.OnSuccess(w, r, res)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func (h *SignInHandlers) fail(w http.ResponseWriter, r *http.Request, err error) {
+	h.log().Warningf("Twitter sign in: %s", err)
+	if h.OnError != nil {
+		h.OnError(w, r, err)
+		return
+	}
+	switch err {
+	case ErrOAuthDenied:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case ErrUnknownTempCredentials:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "cannot sign in with Twitter", http.StatusBadGateway)
+	}
+}
+
+func (h *SignInHandlers) log() Logger {
+	if h.Log == nil {
+		return silentLogger{}
+	}
+	return h.Log
+}
@@ -0,0 +1,137 @@
+package anaconda_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ChimeraCoder/anaconda"
+)
+
+// newFakeOAuthServer serves the request_token and access_token endpoints,
+// expecting callback and accessType in the request_token request
+func newFakeOAuthServer(t *testing.T, callback, accessType string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.Contains(auth, `oauth_consumer_key="consumer"`) {
+			t.Errorf("Unexpected authorization %q", auth)
+		}
+		r.ParseForm()
+		switch r.URL.Path {
+		case "/oauth/request_token":
+			if !strings.Contains(auth, `oauth_callback="`+url.QueryEscape(callback)+`"`) {
+				t.Errorf("Expected callback %q in %q", callback, auth)
+			}
+			if got := r.PostForm.Get("x_auth_access_type"); got != accessType {
+				t.Errorf("Expected x_auth_access_type %q, got %q", accessType, got)
+			}
+			w.Write([]byte("oauth_token=temp&oauth_token_secret=tempsecret&oauth_callback_confirmed=true"))
+		case "/oauth/access_token":
+			if !strings.Contains(auth, `oauth_token="temp"`) || !strings.Contains(auth, `oauth_verifier="1234"`) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte("oauth_token=access&oauth_token_secret=accesssecret&user_id=42&screen_name=gopher"))
+		default:
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+	}))
+}
+
+func Test_TwitterApi_PINAuthorization(t *testing.T) {
+	server := newFakeOAuthServer(t, anaconda.OAuthCallbackOOB, anaconda.AccessTypeWrite)
+	defer server.Close()
+
+	transport := &countingTransport{}
+	api := anaconda.NewTwitterApiWithOptions(
+		anaconda.WithConsumerCredentials("consumer", "consumersecret"),
+		anaconda.WithHttpClient(&http.Client{Transport: transport}),
+		anaconda.WithBaseUrl(server.URL+"/1.1"),
+	)
+	defer api.Close()
+
+	authURL, tempCred, err := api.PINAuthorizationURL(anaconda.AuthorizeOptions{
+		ForceLogin: true,
+		ScreenName: "gopher",
+		AccessType: anaconda.AccessTypeWrite,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if u.Path != "/oauth/authorize" || q.Get("oauth_token") != "temp" || q.Get("force_login") != "true" || q.Get("screen_name") != "gopher" {
+		t.Errorf("Unexpected authorization URL %s", authURL)
+	}
+
+	res, err := api.CompleteAuthorization(tempCred, "1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.UserID != "42" || res.ScreenName != "gopher" || res.Credentials.Token != "access" || res.Credentials.Secret != "accesssecret" {
+		t.Errorf("Unexpected result %+v", res)
+	}
+	if transport.requests != 2 {
+		t.Errorf("Expected the 2 requests through the HTTP client of the API, got %d", transport.requests)
+	}
+
+	if _, _, err := api.AuthorizationURLWithOptions("oob", anaconda.AuthorizeOptions{AccessType: "admin"}); err == nil {
+		t.Error("Expected an error for an invalid access type")
+	}
+}
+
+func Test_SignInHandlers(t *testing.T) {
+	const callback = "https://example.com/twitter/callback"
+	server := newFakeOAuthServer(t, callback, "")
+	defer server.Close()
+
+	api := anaconda.NewTwitterApiWithOptions(
+		anaconda.WithConsumerCredentials("consumer", "consumersecret"),
+		anaconda.WithBaseUrl(server.URL+"/1.1"),
+	)
+	defer api.Close()
+
+	var result *anaconda.OAuthResult
+	h := anaconda.NewSignInHandlers(api, callback)
+	h.OnSuccess = func(w http.ResponseWriter, r *http.Request, res *anaconda.OAuthResult) {
+		result = res
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	w := httptest.NewRecorder()
+	h.Redirect().ServeHTTP(w, httptest.NewRequest("GET", "/twitter/signin", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected a redirect, got %d", w.Code)
+	}
+	if location := w.Header().Get("Location"); location != server.URL+"/oauth/authenticate?oauth_token=temp" {
+		t.Errorf("Unexpected redirect to %s", location)
+	}
+
+	callbackRequest := httptest.NewRequest("GET", "/twitter/callback?oauth_token=temp&oauth_verifier=1234", nil)
+	w = httptest.NewRecorder()
+	h.Callback().ServeHTTP(w, callbackRequest)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected the answer of OnSuccess, got %d %s", w.Code, w.Body)
+	}
+	if result == nil || result.UserID != "42" || result.Credentials.Token != "access" {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	// the temporary credentials are used once
+	w = httptest.NewRecorder()
+	h.Callback().ServeHTTP(w, callbackRequest)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a replayed callback, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.Callback().ServeHTTP(w, httptest.NewRequest("GET", "/twitter/callback?denied=temp", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a denied authorization, got %d", w.Code)
+	}
+}
@@ -22,27 +22,29 @@ type OEmbed struct {
 
 // No authorization on this endpoint. Its the only one.
 func (a TwitterApi) GetOEmbed(v url.Values) (o OEmbed, err error) {
-	resp, err := http.Get(a.baseUrlV1() + "/statuses/oembed.json?" + v.Encode())
-	if err != nil {
-		return
-	}
-	defer resp.Body.Close()
-
-	err = decodeResponse(resp, &o)
-	return
+	return a.getOEmbed(v)
 }
 
 // Calls GetOEmbed with the corresponding id. Convenience wrapper for GetOEmbed()
 func (a TwitterApi) GetOEmbedId(id int64, v url.Values) (o OEmbed, err error) {
 	v = cleanValues(v)
 	v.Set("id", strconv.FormatInt(id, 10))
-	resp, err := http.Get(a.baseUrlV1() + "/statuses/oembed.json?" + v.Encode())
+	return a.getOEmbed(v)
+}
+
+// getOEmbed issues the unauthenticated oembed request, bound to the client's context
+func (a TwitterApi) getOEmbed(v url.Values) (o OEmbed, err error) {
+	req, err := http.NewRequestWithContext(a.Context(), http.MethodGet, a.baseUrlV1()+"/statuses/oembed.json?"+v.Encode(), nil)
+	if err != nil {
+		return
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return
 	}
 	defer resp.Body.Close()
 
-	err = decodeResponse(resp, &o)
+	err = a.decodeResponse(resp, &o)
 	return
 }
 
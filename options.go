@@ -0,0 +1,173 @@
+package anaconda
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ChimeraCoder/tokenbucket"
+	"github.com/azr/backoff"
+	"github.com/garyburd/go-oauth/oauth"
+)
+
+// Option configures a TwitterApi created by NewTwitterApiWithOptions
+type Option func(c *TwitterApi)
+
+//NewTwitterApiWithOptions returns a TwitterApi struct configured by opts alone: unlike NewTwitterApi,
+//it ignores SetConsumerKey and SetConsumerSecret, so that clients of several apps can live in the same process.
+//
+//  api := anaconda.NewTwitterApiWithOptions(
+//      anaconda.WithConsumerCredentials("your-consumer-key", "your-consumer-secret"),
+//      anaconda.WithAccessCredentials("your-access-token", "your-access-token-secret"),
+//      anaconda.WithRetryPolicy(anaconda.DefaultRetryPolicy()),
+//  )
+func NewTwitterApiWithOptions(opts ...Option) *TwitterApi {
+	c := &TwitterApi{
+		Credentials:          &oauth.Credentials{},
+		queryQueue:           make(chan query),
+		pool:                 newQueryPool(DEFAULT_CONCURRENCY),
+		rateLimits:           newRateLimitRegistry(),
+		bucket:               nil,
+		returnRateLimitError: false,
+		HttpClient:           defaultClient,
+		Log:                  silentLogger{},
+		baseUrl:              BaseUrl,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	root := c.oauthBaseUrl()
+	c.oauthClient.TemporaryCredentialRequestURI = root + "/oauth/request_token"
+	c.oauthClient.ResourceOwnerAuthorizationURI = root + "/oauth/authenticate"
+	c.oauthClient.TokenRequestURI = root + "/oauth/access_token"
+	go c.throttledQuery()
+	return c
+}
+
+// WithConsumerCredentials sets the key and secret of the app
+func WithConsumerCredentials(consumerKey, consumerSecret string) Option {
+	return func(c *TwitterApi) {
+		c.oauthClient.Credentials = oauth.Credentials{Token: consumerKey, Secret: consumerSecret}
+	}
+}
+
+// WithAccessCredentials sets the access token and secret of the user
+func WithAccessCredentials(accessToken, accessTokenSecret string) Option {
+	return func(c *TwitterApi) {
+		c.Credentials = &oauth.Credentials{Token: accessToken, Secret: accessTokenSecret}
+	}
+}
+
+// WithAppOnlyCredentials authenticates as the app with a bearer token obtained from its key and secret,
+// see NewTwitterApiAppOnly
+func WithAppOnlyCredentials(consumerKey, consumerSecret string) Option {
+	return func(c *TwitterApi) {
+		c.bearer = &bearerAuth{consumerKey: consumerKey, consumerSecret: consumerSecret}
+	}
+}
+
+// WithBearerToken authenticates as an app with an existing bearer token, see NewTwitterApiWithBearerToken
+func WithBearerToken(token string) Option {
+	return func(c *TwitterApi) {
+		c.bearer = &bearerAuth{token: token}
+	}
+}
+
+// WithHttpClient sets the HTTP client of the queries and, without its overall timeout, of the streams
+func WithHttpClient(client *http.Client) Option {
+	return func(c *TwitterApi) {
+		c.HttpClient = client
+	}
+}
+
+// WithBaseUrl replaces BaseUrl. The OAuth endpoints are expected at the root of the URL, without its version.
+func WithBaseUrl(baseUrl string) Option {
+	return func(c *TwitterApi) {
+		c.baseUrl = baseUrl
+	}
+}
+
+// WithUploadBaseUrl replaces UploadBaseUrl
+func WithUploadBaseUrl(baseUrl string) Option {
+	return func(c *TwitterApi) {
+		c.uploadBaseUrl = baseUrl
+	}
+}
+
+// WithStreamBaseUrl replaces the base URL of every streaming endpoint, see SetStreamBaseUrl
+func WithStreamBaseUrl(baseUrl string) Option {
+	return func(c *TwitterApi) {
+		c.streamBaseUrl = baseUrl
+	}
+}
+
+// WithStreamBackoffs replaces the back off strategies of the streams, see SetStreamBackoffs
+func WithStreamBackoffs(tcpip, http, http420 func() backoff.Interface) Option {
+	return func(c *TwitterApi) {
+		c.SetStreamBackoffs(tcpip, http, http420)
+	}
+}
+
+// WithStreamIdleTimeout sets how long a stream waits for data before reconnecting, see SetStreamIdleTimeout
+func WithStreamIdleTimeout(d time.Duration) Option {
+	return func(c *TwitterApi) {
+		c.SetStreamIdleTimeout(d)
+	}
+}
+
+// WithMaxErrorBodySize bounds how much of the body of an error response is read, see SetMaxErrorBodySize
+func WithMaxErrorBodySize(n int64) Option {
+	return func(c *TwitterApi) {
+		c.maxErrorBodySize = n
+	}
+}
+
+// WithMiddleware adds middlewares around the sending of the requests, see Use
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(c *TwitterApi) {
+		c.Use(middlewares...)
+	}
+}
+
+// WithLogger sets the logger, silent by default
+func WithLogger(l Logger) Option {
+	return func(c *TwitterApi) {
+		if l != nil {
+			c.Log = l
+		}
+	}
+}
+
+// WithThrottling throttles the queries with the tokenbucket algorithm, see EnableThrottling
+func WithThrottling(rate time.Duration, bufferSize int64) Option {
+	return func(c *TwitterApi) {
+		c.bucket = tokenbucket.NewBucket(rate, bufferSize)
+	}
+}
+
+// WithRateLimiter holds the queries of the endpoint families out of calls back, see SetRateLimiter
+func WithRateLimiter(l RateLimiter) Option {
+	return func(c *TwitterApi) {
+		c.rateLimiter = l
+	}
+}
+
+// WithConcurrency sets how many queries may be in flight at once, see SetConcurrency
+func WithConcurrency(n int) Option {
+	return func(c *TwitterApi) {
+		c.SetConcurrency(n)
+	}
+}
+
+// WithRetryPolicy sets the policy retrying the failed queries, see SetRetryPolicy
+func WithRetryPolicy(p *RetryPolicy) Option {
+	return func(c *TwitterApi) {
+		c.retryPolicy = p
+	}
+}
+
+// WithReturnRateLimitError returns the rate limit errors instead of retrying, see ReturnRateLimitError
+func WithReturnRateLimitError(b bool) Option {
+	return func(c *TwitterApi) {
+		c.returnRateLimitError = b
+	}
+}
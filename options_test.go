@@ -0,0 +1,116 @@
+package anaconda_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ChimeraCoder/anaconda"
+)
+
+type countingTransport struct {
+	mu       sync.Mutex
+	requests int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.requests++
+	t.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func Test_NewTwitterApiWithOptions(t *testing.T) {
+	var mu sync.Mutex
+	consumers := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		start := strings.Index(auth, `oauth_consumer_key="`) + len(`oauth_consumer_key="`)
+		mu.Lock()
+		consumers[r.URL.Path] = auth[start : start+strings.Index(auth[start:], `"`)]
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/media/upload.json":
+			w.Write([]byte(`{"media_id_string": "1"}`))
+		default:
+			w.Write([]byte(`{"statuses": []}`))
+		}
+	}))
+	defer server.Close()
+
+	// the global consumer credentials are ignored
+	anaconda.SetConsumerKey("global")
+	defer anaconda.SetConsumerKey("")
+
+	transport := &countingTransport{}
+	first := anaconda.NewTwitterApiWithOptions(
+		anaconda.WithConsumerCredentials("first-app", "secret"),
+		anaconda.WithAccessCredentials("token", "token-secret"),
+		anaconda.WithHttpClient(&http.Client{Transport: transport}),
+		anaconda.WithBaseUrl(server.URL+"/api"),
+		anaconda.WithUploadBaseUrl(server.URL+"/media"),
+		anaconda.WithRetryPolicy(anaconda.DefaultRetryPolicy()),
+		anaconda.WithConcurrency(2),
+	)
+	defer first.Close()
+	second := anaconda.NewTwitterApiWithOptions(
+		anaconda.WithConsumerCredentials("second-app", "secret"),
+		anaconda.WithBaseUrl(server.URL),
+	)
+	defer second.Close()
+
+	if _, err := first.GetSearch("golang", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first.UploadMedia("aGVsbG8="); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.GetSearch("golang", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := map[string]string{
+		"/api/search/tweets.json":  "first-app",
+		"/media/media/upload.json": "first-app",
+		"/search/tweets.json":      "second-app",
+	}
+	for path, consumer := range expected {
+		if consumers[path] != consumer {
+			t.Errorf("Expected %s to be signed for %s, received %v", path, consumer, consumers)
+		}
+	}
+	if transport.requests != 2 {
+		t.Errorf("Expected the 2 queries of the first client to go through its HTTP client, received %d", transport.requests)
+	}
+}
+
+func Test_NewTwitterApiWithOptions_AuthorizationURL(t *testing.T) {
+	const callback = "https://example.com/callback"
+	server := newFakeOAuthServer(t, callback, "")
+	defer server.Close()
+
+	api := anaconda.NewTwitterApiWithOptions(
+		anaconda.WithConsumerCredentials("consumer", "consumersecret"),
+		anaconda.WithBaseUrl(server.URL+"/1.1"),
+	)
+	defer api.Close()
+
+	authURL, tempCred, err := api.AuthorizationURL(callback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authURL != server.URL+"/oauth/authenticate?oauth_token=temp" {
+		t.Errorf("Unexpected authorization URL %s", authURL)
+	}
+	cred, v, err := api.GetCredentials(tempCred, "1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred.Token != "access" || v.Get("screen_name") != "gopher" {
+		t.Errorf("Unexpected credentials %+v, %v", cred, v)
+	}
+}
@@ -0,0 +1,78 @@
+package anaconda
+
+import (
+	"context"
+	"sync"
+)
+
+// queryPool holds the pending queries of each endpoint family, executed in order by a worker per family,
+// and bounds the number of queries in flight across the families
+type queryPool struct {
+	mu       sync.Mutex
+	families map[string][]query
+	slots    chan struct{}
+}
+
+func newQueryPool(concurrency int) *queryPool {
+	return &queryPool{
+		families: make(map[string][]query),
+		slots:    make(chan struct{}, concurrency),
+	}
+}
+
+// push appends q to the queries of its family,
+// it returns true when the family has no worker yet and one must be started
+func (p *queryPool) push(q query) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pending, running := p.families[q.resource]
+	p.families[q.resource] = append(pending, q)
+	return !running
+}
+
+// next returns the next query of the family of resource,
+// or false once there are none left and the worker of the family must stop
+func (p *queryPool) next(resource string) (query, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pending := p.families[resource]
+	if len(pending) == 0 {
+		delete(p.families, resource)
+		return query{}, false
+	}
+	q := pending[0]
+	pending[0] = query{}
+	p.families[resource] = pending[1:]
+	return q, true
+}
+
+// acquire waits for a slot to send a query, the returned function releases it
+func (p *queryPool) acquire(ctx context.Context) (release func(), err error) {
+	p.mu.Lock()
+	slots := p.slots
+	p.mu.Unlock()
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// setConcurrency replaces the slots, the queries in flight release the previous ones
+func (p *queryPool) setConcurrency(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.slots = make(chan struct{}, n)
+}
+
+// SetConcurrency sets how many queries may be in flight at once, DEFAULT_CONCURRENCY by default.
+// The queries of an endpoint family are always executed one after the other, in order,
+// so that a family waiting for its rate limit window does not hold the other ones back.
+// n must be at least 1.
+func (c *TwitterApi) SetConcurrency(n int) {
+	if n < 1 {
+		panic("anaconda: concurrency must be at least 1")
+	}
+	c.pool.setConcurrency(n)
+}
@@ -0,0 +1,114 @@
+package anaconda_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test that a rate limited endpoint family waits for its window without holding the other families back,
+// and that the queries of the family are retried in order
+func Test_TwitterApi_ConcurrentFamilies(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	limited := make(chan struct{})
+	api := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, r.URL.Path+" "+r.URL.Query().Get("cursor"))
+		switch r.URL.Path {
+		case "/followers/ids.json":
+			if len(requests) == 1 {
+				w.Header().Set("X-Rate-Limit-Reset", strconv.FormatInt(time.Now().Add(2*time.Second).Unix(), 10))
+				w.WriteHeader(http.StatusTooManyRequests)
+				w.Write([]byte(`{"errors": [{"code": 88, "message": "Rate limit exceeded"}]}`))
+				close(limited)
+				return
+			}
+			w.Write([]byte(`{"ids": [], "next_cursor_str": "0"}`))
+		case "/search/tweets.json":
+			w.Write([]byte(`{"statuses": []}`))
+		}
+	})
+	api.SetConcurrency(2)
+
+	var wg sync.WaitGroup
+	followers := func(cursor string) {
+		defer wg.Done()
+		if _, err := api.GetFollowersIds(url.Values{"cursor": {cursor}}); err != nil {
+			t.Error(err)
+		}
+	}
+	wg.Add(1)
+	go followers("1")
+	<-limited
+	wg.Add(1)
+	go followers("2")
+
+	start := time.Now()
+	if _, err := api.GetSearch("golang", nil); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("Search was held back %s by the rate limit of followers/ids", d)
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{"/followers/ids.json 1", "/search/tweets.json ", "/followers/ids.json 1", "/followers/ids.json 2"}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Fatalf("Received %q, expected %q", requests, expected)
+	}
+}
+
+// Test that a query waiting behind a rate limited query of its family returns as soon as its context is done
+func Test_TwitterApi_CancelledBehindRateLimit(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	limited := make(chan struct{})
+	api := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, r.URL.Query().Get("cursor"))
+		if len(requests) == 1 {
+			w.Header().Set("X-Rate-Limit-Reset", strconv.FormatInt(time.Now().Add(2*time.Second).Unix(), 10))
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"errors": [{"code": 88, "message": "Rate limit exceeded"}]}`))
+			close(limited)
+			return
+		}
+		w.Write([]byte(`{"ids": [], "next_cursor_str": "0"}`))
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := api.GetFollowersIds(url.Values{"cursor": {"1"}}); err != nil {
+			t.Error(err)
+		}
+	}()
+	<-limited
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := api.WithContext(ctx).GetFollowersIds(url.Values{"cursor": {"2"}}); err != context.DeadlineExceeded {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("The cancelled query returned after %s, behind the rate limited one", d)
+	}
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	if expected := []string{"1", "1"}; !reflect.DeepEqual(requests, expected) {
+		t.Errorf("Received cursors %q, expected %q", requests, expected)
+	}
+}
@@ -1,8 +1,12 @@
 package anaconda
 
 import (
+	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type RateLimitStatusResponse struct {
@@ -24,7 +28,89 @@ func (a TwitterApi) GetRateLimits(r []string) (rateLimitStatusResponse RateLimit
 	resources := strings.Join(r, ",")
 	v := url.Values{}
 	v.Set("resources", resources)
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/application/rate_limit_status.json", v, &rateLimitStatusResponse, _GET, response_ch}
-	return rateLimitStatusResponse, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/application/rate_limit_status.json", v, &rateLimitStatusResponse, _GET)
+	return rateLimitStatusResponse, err
+}
+
+// RateLimit is the rate limit state of an endpoint family, as of its last response
+type RateLimit struct {
+	// Resource is the endpoint family as named by GetRateLimits, such as "/search/tweets"
+	Resource  string
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// parseRateLimit reads the x-rate-limit-limit, x-rate-limit-remaining and x-rate-limit-reset headers,
+// it returns false if remaining or reset is missing. Limit is 0 when unknown.
+func parseRateLimit(resource string, header http.Header) (RateLimit, bool) {
+	remaining, rerr := strconv.Atoi(header.Get("X-Rate-Limit-Remaining"))
+	reset, serr := strconv.ParseInt(header.Get("X-Rate-Limit-Reset"), 10, 64)
+	if rerr != nil || serr != nil {
+		return RateLimit{}, false
+	}
+	limit, _ := strconv.Atoi(header.Get("X-Rate-Limit-Limit"))
+	return RateLimit{Resource: resource, Limit: limit, Remaining: remaining, Reset: time.Unix(reset, 0)}, true
+}
+
+// rateLimitRegistry records the last rate limit state of every endpoint family
+type rateLimitRegistry struct {
+	mu        sync.Mutex
+	limits    map[string]RateLimit
+	threshold int
+	hook      func(RateLimit)
+}
+
+func newRateLimitRegistry() *rateLimitRegistry {
+	return &rateLimitRegistry{limits: make(map[string]RateLimit)}
+}
+
+// record stores the state of the headers of a response, and calls the hook
+// when the remaining calls of the window drop below the threshold
+func (r *rateLimitRegistry) record(resource string, header http.Header) {
+	l, ok := parseRateLimit(resource, header)
+	if !ok {
+		return
+	}
+	r.mu.Lock()
+	previous, seen := r.limits[resource]
+	r.limits[resource] = l
+	hook, threshold := r.hook, r.threshold
+	r.mu.Unlock()
+
+	crossed := !seen || previous.Remaining >= threshold || !previous.Reset.Equal(l.Reset)
+	if hook != nil && l.Remaining < threshold && crossed {
+		hook(l)
+	}
+}
+
+// RateLimit returns the rate limit state of resource, such as "/search/tweets", as of its last response.
+// It returns false when no response of resource carried rate limit headers yet.
+func (c TwitterApi) RateLimit(resource string) (RateLimit, bool) {
+	c.rateLimits.mu.Lock()
+	defer c.rateLimits.mu.Unlock()
+	l, ok := c.rateLimits.limits[resource]
+	return l, ok
+}
+
+// RateLimits returns the rate limit state of every endpoint family called so far, keyed by resource
+func (c TwitterApi) RateLimits() map[string]RateLimit {
+	c.rateLimits.mu.Lock()
+	defer c.rateLimits.mu.Unlock()
+	limits := make(map[string]RateLimit, len(c.rateLimits.limits))
+	for resource, l := range c.rateLimits.limits {
+		limits[resource] = l
+	}
+	return limits
+}
+
+// SetRateLimitHook calls hook when the remaining calls of an endpoint family drop below threshold,
+// once per window. hook is called from the goroutine executing the query, before the query returns:
+// it must not block, nor wait for another query.
+// A nil hook removes it.
+func (c *TwitterApi) SetRateLimitHook(threshold int, hook func(RateLimit)) {
+	c.rateLimits.mu.Lock()
+	defer c.rateLimits.mu.Unlock()
+	c.rateLimits.threshold = threshold
+	c.rateLimits.hook = hook
 }
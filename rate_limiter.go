@@ -0,0 +1,223 @@
+package anaconda
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitWindow is the length of the rate limit windows of the Twitter API
+const RateLimitWindow = 15 * time.Minute
+
+// DefaultRateLimits are the documented number of calls per 15 minute window of the most used
+// endpoint families with user authentication, keyed by resource as in GetRateLimits
+// https://developer.twitter.com/en/docs/basics/rate-limits
+var DefaultRateLimits = map[string]int{
+	"/account/verify_credentials":    75,
+	"/application/rate_limit_status": 180,
+	"/blocks/ids":                    15,
+	"/blocks/list":                   15,
+	"/direct_messages/events/list":   15,
+	"/direct_messages/events/show":   15,
+	"/favorites/list":                75,
+	"/followers/ids":                 15,
+	"/followers/list":                15,
+	"/friends/ids":                   15,
+	"/friends/list":                  15,
+	"/friendships/incoming":          15,
+	"/friendships/lookup":            15,
+	"/friendships/outgoing":          15,
+	"/friendships/show":              180,
+	"/geo/id/:place_id":              75,
+	"/geo/reverse_geocode":           15,
+	"/geo/search":                    15,
+	"/lists/list":                    15,
+	"/lists/members":                 900,
+	"/lists/memberships":             75,
+	"/lists/ownerships":              15,
+	"/lists/show":                    75,
+	"/lists/statuses":                900,
+	"/lists/subscriptions":           15,
+	"/mutes/users/ids":               15,
+	"/mutes/users/list":              15,
+	"/search/tweets":                 180,
+	"/statuses/home_timeline":        15,
+	"/statuses/lookup":               900,
+	"/statuses/mentions_timeline":    75,
+	"/statuses/retweeters/ids":       75,
+	"/statuses/retweets/:id":         75,
+	"/statuses/retweets_of_me":       75,
+	"/statuses/show/:id":             900,
+	"/statuses/user_timeline":        900,
+	"/trends/available":              75,
+	"/trends/closest":                75,
+	"/trends/place":                  75,
+	"/users/lookup":                  900,
+	"/users/search":                  900,
+	"/users/show/:id":                900,
+	"/users/suggestions":             15,
+	"/users/suggestions/:slug":       15,
+}
+
+// RateLimiter holds the queries of an endpoint family back once it ran out of calls in the current window,
+// see SetRateLimiter. Resources are the paths of the endpoints as in GetRateLimits, such as "/search/tweets".
+type RateLimiter interface {
+	// Wait blocks until a call to resource may be made, or ctx is done
+	Wait(ctx context.Context, resource string) error
+
+	// Update records the rate limit headers of a response of resource
+	Update(resource string, header http.Header)
+}
+
+// EndpointRateLimiter is a RateLimiter with a bucket of calls per resource,
+// refilled at the end of each window. The buckets follow the x-rate-limit-remaining and x-rate-limit-reset
+// headers of every response, resources without a bucket are not limited.
+//
+//  limiter := anaconda.NewEndpointRateLimiter(anaconda.DefaultRateLimits)
+//  api.SetRateLimiter(limiter)
+//  if status, err := api.GetRateLimits([]string{"search", "followers"}); err == nil {
+//      limiter.Seed(status)
+//  }
+type EndpointRateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*rateLimitBucket
+}
+
+type rateLimitBucket struct {
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+// NewEndpointRateLimiter returns a limiter whose buckets are seeded with limits,
+// the number of calls per window of each resource, such as DefaultRateLimits
+func NewEndpointRateLimiter(limits map[string]int) *EndpointRateLimiter {
+	l := &EndpointRateLimiter{buckets: make(map[string]*rateLimitBucket)}
+	for resource, limit := range limits {
+		l.buckets[resource] = &rateLimitBucket{limit: limit, remaining: limit}
+	}
+	return l
+}
+
+// Seed sets the buckets to the state returned by GetRateLimits
+func (l *EndpointRateLimiter) Seed(status RateLimitStatusResponse) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, resources := range status.Resources {
+		for resource, r := range resources {
+			l.buckets[resource] = &rateLimitBucket{
+				limit:     r.Limit,
+				remaining: r.Remaining,
+				reset:     time.Unix(int64(r.Reset), 0),
+			}
+		}
+	}
+}
+
+// Wait takes a call from the bucket of resource, waiting for the end of the window when it is empty
+func (l *EndpointRateLimiter) Wait(ctx context.Context, resource string) error {
+	for {
+		delay := l.take(resource)
+		if delay <= 0 {
+			return nil
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// take takes a call from the bucket of resource,
+// or returns how long to wait for the bucket to be refilled
+func (l *EndpointRateLimiter) take(resource string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[resource]
+	if !ok {
+		return 0
+	}
+	now := time.Now()
+	if !now.Before(b.reset) {
+		if b.limit <= 0 {
+			// the limit of the resource is unknown
+			return 0
+		}
+		// a new window starts with the first call
+		b.remaining = b.limit
+		b.reset = now.Add(RateLimitWindow)
+	}
+	if b.remaining <= 0 {
+		return b.reset.Sub(now)
+	}
+	b.remaining--
+	return 0
+}
+
+// Update sets the bucket of resource to the state of the x-rate-limit-limit,
+// x-rate-limit-remaining and x-rate-limit-reset headers, when present
+func (l *EndpointRateLimiter) Update(resource string, header http.Header) {
+	state, ok := parseRateLimit(resource, header)
+	if !ok {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[resource]
+	if !ok {
+		b = &rateLimitBucket{}
+		l.buckets[resource] = b
+	}
+	if state.Limit > 0 {
+		b.limit = state.Limit
+	}
+	b.remaining = state.Remaining
+	b.reset = state.Reset
+}
+
+// SetRateLimiter holds the queries of the endpoint families out of calls back with l,
+// so that a family being rate limited does not delay the queries of the other ones.
+// A nil limiter disables rate limiting, which is the default.
+func (c *TwitterApi) SetRateLimiter(l RateLimiter) {
+	c.rateLimiter = l
+}
+
+// rateLimitResource returns the resource of the endpoint of u as named by GetRateLimits,
+// such as "/statuses/show/:id" for https://api.twitter.com/1.1/statuses/show.json?id=20
+func rateLimitResource(u *url.URL) string {
+	path := strings.TrimSuffix(u.Path, ".json")
+	for _, version := range []string{"/1.1/", "/1/"} {
+		if strings.HasPrefix(path, version) {
+			path = path[len(version)-1:]
+		}
+	}
+
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+			segments[i] = ":id"
+		}
+	}
+	if len(segments) > 3 {
+		switch segments[1] + "/" + segments[2] {
+		case "geo/id":
+			segments[3] = ":place_id"
+		case "users/suggestions":
+			segments[3] = ":slug"
+		}
+	}
+	path = strings.Join(segments, "/")
+
+	if path == "/statuses/show" || path == "/users/show" {
+		return path + "/:id"
+	}
+	return path
+}
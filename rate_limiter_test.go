@@ -0,0 +1,121 @@
+package anaconda_test
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ChimeraCoder/anaconda"
+)
+
+func Test_EndpointRateLimiter(t *testing.T) {
+	var mu sync.Mutex
+	hits := map[string]int{}
+	reset := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	api := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/followers/ids.json":
+			w.Header().Set("X-Rate-Limit-Limit", "15")
+			w.Header().Set("X-Rate-Limit-Remaining", "0")
+			w.Header().Set("X-Rate-Limit-Reset", reset)
+			w.Write([]byte(`{"ids": [1, 2], "next_cursor_str": "0"}`))
+		case "/search/tweets.json":
+			w.Write([]byte(`{"statuses": []}`))
+		case "/statuses/show.json":
+			w.Write([]byte(`{"id_str": "20"}`))
+		default:
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+	})
+	api.SetRateLimiter(anaconda.NewEndpointRateLimiter(map[string]int{"/statuses/show/:id": 2}))
+
+	if _, err := api.GetFollowersIds(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// followers/ids is out of calls until the reset header, search is not held back
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := api.WithContext(ctx).GetFollowersIds(nil); err != context.DeadlineExceeded {
+		t.Fatalf("Expected the second followers/ids call to wait for the next window, received %v", err)
+	}
+	if _, err := api.GetSearch("golang", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// statuses/show is seeded with 2 calls per window
+	for i := 0; i < 2; i++ {
+		if _, err := api.GetTweet(20, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := api.WithContext(ctx).GetTweet(20, nil); err != context.DeadlineExceeded {
+		t.Fatalf("Expected the third statuses/show call to wait for the next window, received %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if hits["/followers/ids.json"] != 1 || hits["/search/tweets.json"] != 1 || hits["/statuses/show.json"] != 2 {
+		t.Fatalf("Unexpected requests %v", hits)
+	}
+}
+
+func Test_EndpointRateLimiter_Seed(t *testing.T) {
+	limiter := anaconda.NewEndpointRateLimiter(nil)
+	limiter.Seed(anaconda.RateLimitStatusResponse{Resources: map[string]map[string]anaconda.BaseResource{
+		"search": {"/search/tweets": {Limit: 180, Remaining: 0, Reset: int(time.Now().Add(time.Hour).Unix())}},
+	}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx, "/search/tweets"); err != context.DeadlineExceeded {
+		t.Fatalf("Expected /search/tweets to wait for the reset, received %v", err)
+	}
+	if err := limiter.Wait(ctx, "/followers/ids"); err != nil {
+		t.Fatalf("Expected a resource without limit to go through, received %v", err)
+	}
+}
+
+func Test_TwitterApi_RateLimit(t *testing.T) {
+	reset := time.Now().Add(10 * time.Minute).Truncate(time.Second)
+	remaining := 4
+	api := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Rate-Limit-Limit", "180")
+		w.Header().Set("X-Rate-Limit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-Rate-Limit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		remaining--
+		w.Write([]byte(`{"statuses": []}`))
+	})
+
+	var alerts []anaconda.RateLimit
+	api.SetRateLimitHook(3, func(l anaconda.RateLimit) { alerts = append(alerts, l) })
+
+	if _, ok := api.RateLimit("/search/tweets"); ok {
+		t.Fatalf("Expected no rate limit state before the first call")
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := api.GetSearch("golang", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := anaconda.RateLimit{Resource: "/search/tweets", Limit: 180, Remaining: 1, Reset: reset}
+	if l, ok := api.RateLimit("/search/tweets"); !ok || !reflect.DeepEqual(l, expected) {
+		t.Fatalf("Expected %+v, received %+v", expected, l)
+	}
+	if limits := api.RateLimits(); len(limits) != 1 {
+		t.Fatalf("Expected the state of a single resource, received %+v", limits)
+	}
+	if len(alerts) != 1 || alerts[0].Remaining != 2 {
+		t.Fatalf("Expected a single alert once remaining dropped below 3, received %+v", alerts)
+	}
+}
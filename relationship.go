@@ -34,7 +34,6 @@ type Source struct {
 }
 
 func (a TwitterApi) GetFriendshipsShow(v url.Values) (relationshipResponse RelationshipResponse, err error) {
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/friendships/show.json", v, &relationshipResponse, _GET, response_ch}
-	return relationshipResponse, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/friendships/show.json", v, &relationshipResponse, _GET)
+	return relationshipResponse, err
 }
@@ -0,0 +1,169 @@
+package anaconda
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy decides whether a failed query is sent again and how long to wait before, see SetRetryPolicy.
+//
+// Rate limits (HTTP 429 or 420, error code 88) are retried once the rate limit window is over.
+// Over capacity errors (code 130) and connections which could not be established
+// are retried after an exponential back off, as Twitter did not process the request.
+// Internal errors (code 131), the other 5xx statuses, including a 503 without code 130 which may come
+// from a gateway after the request was forwarded, and the other network errors
+// are retried only for the idempotent methods GET, PUT and DELETE:
+// Twitter may have processed a POST, such as PostTweet, and it is never sent twice.
+type RetryPolicy struct {
+	// MaxAttempts bounds the number of times a query is sent, 0 means no bound
+	MaxAttempts int
+
+	// MaxWait bounds the total time spent waiting before the retries of a query, 0 means no bound.
+	// A retry which would exceed it is not made and the error is returned.
+	MaxWait time.Duration
+
+	// BaseDelay is the wait before the first retry of a transient error, doubled on every attempt up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// Jitter is the bound of a random duration added to every wait,
+	// so that the clients failing together do not retry in lockstep
+	Jitter time.Duration
+}
+
+// DefaultRetryPolicy returns a policy making up to 5 attempts within 20 minutes,
+// enough to wait for a rate limit window
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 5,
+		MaxWait:     20 * time.Minute,
+		BaseDelay:   time.Second,
+		MaxDelay:    time.Minute,
+		Jitter:      time.Second,
+	}
+}
+
+// Retry reports whether a query sent with method, which failed with err on its attempt-th try
+// after waiting waited in total before its previous retries, is sent again after wait.
+func (p *RetryPolicy) Retry(method string, attempt int, waited time.Duration, err error) (wait time.Duration, retry bool) {
+	if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+		return 0, false
+	}
+
+	idempotent := method == http.MethodGet || method == http.MethodPut || method == http.MethodDelete
+	switch classifyRetry(err) {
+	case retryRateLimit:
+		_, nextWindow := err.(*ApiError).RateLimitCheck()
+		wait = time.Until(nextWindow)
+		if wait < 0 {
+			wait = 0
+		}
+	case retryUnprocessed:
+		wait = p.backOff(attempt)
+	case retryTransient:
+		if !idempotent {
+			return 0, false
+		}
+		wait = p.backOff(attempt)
+	default:
+		return 0, false
+	}
+
+	if p.Jitter > 0 {
+		wait += time.Duration(rand.Int63n(int64(p.Jitter)))
+	}
+	if p.MaxWait > 0 && waited+wait > p.MaxWait {
+		return 0, false
+	}
+	return wait, true
+}
+
+// backOff returns BaseDelay doubled for every attempt after the first one, up to MaxDelay
+func (p *RetryPolicy) backOff(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+type retryKind int
+
+const (
+	retryNever retryKind = iota
+	retryRateLimit
+	// the request was not processed, it is safe to retry any method
+	retryUnprocessed
+	// the request may have been processed
+	retryTransient
+)
+
+func classifyRetry(err error) retryKind {
+	if apiErr, ok := err.(*ApiError); ok {
+		switch {
+		case errors.Is(apiErr, ErrRateLimited):
+			return retryRateLimit
+		case apiErr.Decoded.Is(ErrOverCapacity):
+			// only the code tells that twitter did not process the request, not the status
+			return retryUnprocessed
+		case errors.Is(apiErr, ErrInternalError), apiErr.StatusCode >= 500:
+			return retryTransient
+		}
+		return retryNever
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return retryUnprocessed
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return retryTransient
+	}
+	return retryNever
+}
+
+// SetRetryPolicy sets the policy retrying the failed queries, see RetryPolicy.
+// Without a policy, the default, rate limited queries are retried once the window is over
+// until they succeed or their context is done, and the other errors are returned right away.
+// ReturnRateLimitError(true) returns rate limit errors right away in any case.
+func (c *TwitterApi) SetRetryPolicy(p *RetryPolicy) {
+	c.retryPolicy = p
+}
+
+// retryWait reports whether q, which failed with err on its attempt-th try, is sent again and after how long
+func (c *TwitterApi) retryWait(q query, attempt int, waited time.Duration, err error) (time.Duration, bool) {
+	if apiErr, ok := err.(*ApiError); ok && c.returnRateLimitError {
+		if isRateLimitError, _ := apiErr.RateLimitCheck(); isRateLimitError {
+			return 0, false
+		}
+	}
+	if c.retryPolicy != nil {
+		return c.retryPolicy.Retry(queryMethod(q.method), attempt, waited, err)
+	}
+
+	if classifyRetry(err) != retryRateLimit {
+		return 0, false
+	}
+	_, nextWindow := err.(*ApiError).RateLimitCheck()
+	return time.Until(nextWindow), true
+}
+
+// queryMethod returns the HTTP method of a query method
+func queryMethod(method int) string {
+	switch method {
+	case _GET:
+		return http.MethodGet
+	case _DELETE:
+		return http.MethodDelete
+	case _PUT:
+		return http.MethodPut
+	}
+	return http.MethodPost
+}
@@ -0,0 +1,118 @@
+package anaconda_test
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ChimeraCoder/anaconda"
+)
+
+func Test_ApiError_RateLimitCheck(t *testing.T) {
+	reset := time.Now().Add(5 * time.Minute).Truncate(time.Second)
+	tests := []struct {
+		name      string
+		err       anaconda.ApiError
+		rateLimit bool
+		window    time.Duration
+	}{
+		{"429", anaconda.ApiError{StatusCode: 429, Header: http.Header{"X-Rate-Limit-Reset": {strconv.FormatInt(reset.Unix(), 10)}}}, true, time.Until(reset)},
+		{"420 without reset", anaconda.ApiError{StatusCode: 420, Header: http.Header{}}, true, 15 * time.Minute},
+		{"code 88", anaconda.ApiError{StatusCode: 400, Header: http.Header{}, Decoded: anaconda.TwitterErrorResponse{Errors: []anaconda.TwitterError{{Code: 88}}}}, true, 15 * time.Minute},
+		{"over capacity", anaconda.ApiError{StatusCode: 503, Header: http.Header{}, Decoded: anaconda.TwitterErrorResponse{Errors: []anaconda.TwitterError{{Code: 130}}}}, false, 0},
+	}
+	for _, test := range tests {
+		isRateLimitError, nextWindow := test.err.RateLimitCheck()
+		if isRateLimitError != test.rateLimit {
+			t.Errorf("%s: expected rate limit %t, received %t", test.name, test.rateLimit, isRateLimitError)
+		}
+		if d := time.Until(nextWindow) - test.window; test.rateLimit && (d > time.Second || d < -time.Second) {
+			t.Errorf("%s: expected the next window in %s, received %s", test.name, test.window, nextWindow)
+		}
+	}
+}
+
+func Test_RetryPolicy(t *testing.T) {
+	p := &anaconda.RetryPolicy{MaxAttempts: 3, MaxWait: time.Minute, BaseDelay: time.Second, MaxDelay: 3 * time.Second}
+	overCapacity := &anaconda.ApiError{StatusCode: 503, Header: http.Header{}, Decoded: anaconda.TwitterErrorResponse{Errors: []anaconda.TwitterError{{Code: 130}}}}
+	unavailable := &anaconda.ApiError{StatusCode: 503, Header: http.Header{}}
+	internal := &anaconda.ApiError{StatusCode: 500, Header: http.Header{}, Decoded: anaconda.TwitterErrorResponse{Errors: []anaconda.TwitterError{{Code: 131}}}}
+	rateLimited := &anaconda.ApiError{StatusCode: 429, Header: http.Header{}}
+	notFound := &anaconda.ApiError{StatusCode: 404, Header: http.Header{}}
+	dial := &url.Error{Op: "Post", Err: &net.OpError{Op: "dial", Err: &net.DNSError{IsTimeout: true}}}
+	read := &url.Error{Op: "Post", Err: &net.OpError{Op: "read", Err: &net.DNSError{IsTimeout: true}}}
+
+	tests := []struct {
+		name    string
+		method  string
+		attempt int
+		waited  time.Duration
+		err     error
+		wait    time.Duration
+		retry   bool
+	}{
+		{"over capacity POST", "POST", 1, 0, overCapacity, time.Second, true},
+		{"back off doubles", "GET", 2, 0, overCapacity, 2 * time.Second, true},
+		{"bare 503 POST", "POST", 1, 0, unavailable, 0, false},
+		{"bare 503 GET", "GET", 1, 0, unavailable, time.Second, true},
+		{"internal error GET", "GET", 1, 0, internal, time.Second, true},
+		{"internal error POST", "POST", 1, 0, internal, 0, false},
+		{"max attempts", "GET", 3, 0, internal, 0, false},
+		{"rate limit beyond max wait", "POST", 1, 0, rateLimited, 0, false},
+		{"not found", "GET", 1, 0, notFound, 0, false},
+		{"dial error POST", "POST", 1, 0, dial, time.Second, true},
+		{"read error POST", "POST", 1, 0, read, 0, false},
+		{"read error GET", "GET", 1, 0, read, time.Second, true},
+		{"max wait", "GET", 1, 59500 * time.Millisecond, internal, 0, false},
+	}
+	for _, test := range tests {
+		wait, retry := p.Retry(test.method, test.attempt, test.waited, test.err)
+		if wait != test.wait || retry != test.retry {
+			t.Errorf("%s: expected %s %t, received %s %t", test.name, test.wait, test.retry, wait, retry)
+		}
+	}
+}
+
+func Test_TwitterApi_SetRetryPolicy(t *testing.T) {
+	var mu sync.Mutex
+	hits := map[string]int{}
+	api := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		n := hits[r.URL.Path]
+		mu.Unlock()
+		switch {
+		case r.URL.Path == "/search/tweets.json" && n < 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"errors": [{"code": 130, "message": "Over capacity"}]}`))
+		case r.URL.Path == "/search/tweets.json":
+			w.Write([]byte(`{"statuses": []}`))
+		case r.URL.Path == "/statuses/retweet/1.json":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/statuses/update.json":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"errors": [{"code": 131, "message": "Internal error"}]}`))
+		}
+	})
+	api.SetRetryPolicy(&anaconda.RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond, Jitter: time.Millisecond})
+
+	if _, err := api.GetSearch("golang", nil); err != nil {
+		t.Fatalf("Expected the over capacity errors to be retried, received %v", err)
+	}
+	if _, err := api.PostTweet("hello", nil); err == nil {
+		t.Fatalf("Expected the internal error of a POST to be returned")
+	}
+	if _, err := api.Retweet(1, false); err == nil {
+		t.Fatalf("Expected the 503 of a POST without code 130 to be returned")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if hits["/search/tweets.json"] != 3 || hits["/statuses/update.json"] != 1 || hits["/statuses/retweet/1.json"] != 1 {
+		t.Fatalf("Unexpected requests %v", hits)
+	}
+}
@@ -46,12 +46,6 @@ func (sr *SearchResponse) GetNext(a *TwitterApi) (SearchResponse, error) {
 func (a TwitterApi) GetSearch(queryString string, v url.Values) (sr SearchResponse, err error) {
 	v = cleanValues(v)
 	v.Set("q", queryString)
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/search/tweets.json", v, &sr, _GET, response_ch}
-
-	// We have to read from the response channel before assigning to timeline
-	// Otherwise this will happen before the responses have been written
-	resp := <-response_ch
-	err = resp.err
+	err = a.sendQuery(a.baseUrl+"/search/tweets.json", v, &sr, _GET)
 	return sr, err
 }
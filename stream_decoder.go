@@ -0,0 +1,325 @@
+package anaconda
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// StreamMessage is a message received on a Stream:
+// Tweet, StatusDeletionNotice, DirectMessageDeletionNotice, LocationDeletionNotice,
+// LimitNotice, StatusWithheldNotice, UserWithheldNotice, DisconnectMessage,
+// StallWarning, TooManyFollow, FriendsList, DirectMessage, EventTweet, EventList,
+// Event, EventFollow or UnknownMessage, or a StreamStatusEvent reporting the state of the connection,
+// or a StreamErrorEvent reporting a message which could not be read.
+//
+//  switch m := msg.(type) {
+//  case anaconda.Tweet:
+//      fmt.Println(m.Text)
+//  case anaconda.StatusDeletionNotice:
+//      fmt.Println("deleted", m.IdStr)
+//  }
+type StreamMessage interface {
+	streamMessage()
+}
+
+// UnknownMessage is the raw JSON of a stream message of a type DecodeStreamMessage does not know
+type UnknownMessage json.RawMessage
+
+func (Tweet) streamMessage()                       {}
+func (StatusDeletionNotice) streamMessage()        {}
+func (DirectMessageDeletionNotice) streamMessage() {}
+func (LocationDeletionNotice) streamMessage()      {}
+func (LimitNotice) streamMessage()                 {}
+func (StatusWithheldNotice) streamMessage()        {}
+func (UserWithheldNotice) streamMessage()          {}
+func (DisconnectMessage) streamMessage()           {}
+func (StallWarning) streamMessage()                {}
+func (TooManyFollow) streamMessage()               {}
+func (FriendsList) streamMessage()                 {}
+func (DirectMessage) streamMessage()               {}
+func (EventTweet) streamMessage()                  {}
+func (EventList) streamMessage()                   {}
+func (Event) streamMessage()                       {}
+func (EventFollow) streamMessage()                 {}
+func (UnknownMessage) streamMessage()              {}
+
+var errNotAnObject = errors.New("anaconda: stream message is not a JSON object")
+
+// tweetFields is a Tweet without its UnmarshalJSON method, to be embedded in streamProbe
+type tweetFields Tweet
+
+// streamProbe is decoded from every stream message: a tweet fills the embedded fields,
+// any other message fills the raw value of its key
+type streamProbe struct {
+	tweetFields
+
+	Delete         json.RawMessage `json:"delete"`
+	ScrubGeo       json.RawMessage `json:"scrub_geo"`
+	Limit          json.RawMessage `json:"limit"`
+	StatusWithheld json.RawMessage `json:"status_withheld"`
+	UserWithheld   json.RawMessage `json:"user_withheld"`
+	Disconnect     json.RawMessage `json:"disconnect"`
+	Warning        json.RawMessage `json:"warning"`
+	Friends        json.RawMessage `json:"friends"`
+	DirectMessage  json.RawMessage `json:"direct_message"`
+	Event          json.RawMessage `json:"event"`
+}
+
+// DecodeStreamMessage decodes a message of the streaming API to its type.
+//
+// The message is decoded once, as a Tweet (keyed by id_str, text or full_text)
+// along with the raw values of the keys of the other messages. A notice such as {"limit":{"track":42}}
+// is then decoded from the value of its single key, and an Event (keyed by event) from the whole message.
+// Messages of an unknown type are returned as an UnknownMessage, a copy of j,
+// along with the error when j is not a valid JSON object.
+func DecodeStreamMessage(j []byte) (StreamMessage, error) {
+	if trimmed := bytes.TrimLeft(j, " \t\r\n"); len(trimmed) == 0 || trimmed[0] != '{' {
+		return unknownMessage(j), errNotAnObject
+	}
+	var p streamProbe
+	err := json.Unmarshal(j, &p)
+	if _, ok := err.(*json.UnmarshalTypeError); err != nil && !ok {
+		return unknownMessage(j), err
+	}
+
+	// the fields of the events, such as source, do not have the types of the fields of a tweet
+	switch {
+	case p.Event != nil:
+		return decodeEvent(j)
+	case err != nil:
+		return unknownMessage(j), err
+	case p.Delete != nil:
+		var o struct {
+			Status        *StatusDeletionNotice        `json:"status"`
+			DirectMessage *DirectMessageDeletionNotice `json:"direct_message"`
+		}
+		if err := json.Unmarshal(p.Delete, &o); err != nil {
+			return unknownMessage(j), err
+		}
+		switch {
+		case o.Status != nil:
+			return *o.Status, nil
+		case o.DirectMessage != nil:
+			return *o.DirectMessage, nil
+		}
+	case p.ScrubGeo != nil:
+		var o LocationDeletionNotice
+		return decodeStreamMessage(j, p.ScrubGeo, &o, func() StreamMessage { return o })
+	case p.Limit != nil:
+		var o LimitNotice
+		return decodeStreamMessage(j, p.Limit, &o, func() StreamMessage { return o })
+	case p.StatusWithheld != nil:
+		var o StatusWithheldNotice
+		return decodeStreamMessage(j, p.StatusWithheld, &o, func() StreamMessage { return o })
+	case p.UserWithheld != nil:
+		var o UserWithheldNotice
+		return decodeStreamMessage(j, p.UserWithheld, &o, func() StreamMessage { return o })
+	case p.Disconnect != nil:
+		var o DisconnectMessage
+		return decodeStreamMessage(j, p.Disconnect, &o, func() StreamMessage { return o })
+	case p.Warning != nil:
+		var o TooManyFollow
+		if err := json.Unmarshal(p.Warning, &o.Warning); err != nil {
+			return unknownMessage(j), err
+		}
+		if o.Warning != nil && o.Warning.Code == "FOLLOWS_OVER_LIMIT" {
+			return o, nil
+		}
+		var w StallWarning
+		return decodeStreamMessage(j, p.Warning, &w, func() StreamMessage { return w })
+	case p.Friends != nil:
+		var o FriendsList
+		return decodeStreamMessage(j, p.Friends, &o, func() StreamMessage { return o })
+	case p.DirectMessage != nil:
+		var o DirectMessage
+		return decodeStreamMessage(j, p.DirectMessage, &o, func() StreamMessage { return o })
+	case p.IdStr != "" || p.Text != "" || p.FullText != "":
+		t := Tweet(p.tweetFields)
+		t.extractExtendedTweet()
+		return t, nil
+	}
+	return unknownMessage(j), nil
+}
+
+// decodeStreamMessage unmarshals data to o and returns the message built by m,
+// or an UnknownMessage if data cannot be decoded
+func decodeStreamMessage(j, data []byte, o interface{}, m func() StreamMessage) (StreamMessage, error) {
+	if err := json.Unmarshal(data, o); err != nil {
+		return unknownMessage(j), err
+	}
+	return m(), nil
+}
+
+// decodeEvent decodes a user stream event to EventTweet, EventList, Event or EventFollow
+// depending on its target_object
+func decodeEvent(j []byte) (StreamMessage, error) {
+	var e struct {
+		Event
+		TargetObject json.RawMessage `json:"target_object"`
+	}
+	if err := json.Unmarshal(j, &e); err != nil {
+		return unknownMessage(j), err
+	}
+	if len(e.TargetObject) == 0 || string(e.TargetObject) == "null" {
+		return EventFollow{e.Event}, nil
+	}
+
+	var kind struct {
+		Source *json.RawMessage `json:"source"`
+		Slug   *string          `json:"slug"`
+	}
+	if err := json.Unmarshal(e.TargetObject, &kind); err != nil {
+		return e.Event, nil
+	}
+	switch {
+	case kind.Source != nil:
+		o := EventTweet{Event: e.Event}
+		return decodeStreamMessage(j, e.TargetObject, &o.TargetObject, func() StreamMessage { return o })
+	case kind.Slug != nil:
+		o := EventList{Event: e.Event}
+		return decodeStreamMessage(j, e.TargetObject, &o.TargetObject, func() StreamMessage { return o })
+	}
+	return e.Event, nil
+}
+
+// unknownMessage copies j, which may be reused by the reader of the stream
+func unknownMessage(j []byte) UnknownMessage {
+	return UnknownMessage(append([]byte(nil), j...))
+}
+
+// StreamHandler dispatches the messages of a Stream to typed callbacks.
+// Callbacks are optional, messages without a callback are dropped.
+//
+// OnStallWarning receives the warnings of a client falling behind, with how full its queue
+// on the Twitter side is in PercentFull, when the stream is requested with stall_warnings=true.
+// OnStatus receives the StreamStalled events of a connection silent for too long.
+//
+//  h := anaconda.StreamHandler{
+//      OnTweet: func(t anaconda.Tweet) { fmt.Println(t.Text) },
+//      OnLimit: func(l anaconda.LimitNotice) { fmt.Println("missed", l.Track) },
+//  }
+//  h.Listen(api.PublicStreamFilter(v))
+type StreamHandler struct {
+	OnTweet               func(t Tweet)
+	OnDelete              func(n StatusDeletionNotice)
+	OnDirectMessageDelete func(n DirectMessageDeletionNotice)
+	OnScrubGeo            func(n LocationDeletionNotice)
+	OnLimit               func(n LimitNotice)
+	OnStatusWithheld      func(n StatusWithheldNotice)
+	OnUserWithheld        func(n UserWithheldNotice)
+	OnDisconnect          func(m DisconnectMessage)
+	OnStallWarning        func(w StallWarning)
+	OnTooManyFollows      func(w TooManyFollow)
+	OnFriendsList         func(l FriendsList)
+	OnDirectMessage       func(m DirectMessage)
+
+	// OnEventTweet and OnEventList receive the events about a Tweet or a List,
+	// OnEvent receives the other events, and the events about a Tweet or a List
+	// when their own callback is not set
+	OnEventTweet func(e EventTweet)
+	OnEventList  func(e EventList)
+	OnEvent      func(e Event)
+
+	// OnUnknown receives the messages DecodeStreamMessage does not know
+	OnUnknown func(m UnknownMessage)
+
+	// OnStatus receives the connections, disconnections and reconnect attempts of the stream
+	OnStatus func(e StreamStatusEvent)
+
+	// OnError receives the messages which could not be read, such as those over the maximum size
+	OnError func(e StreamErrorEvent)
+}
+
+// Handle calls the callback registered for the type of m
+func (h *StreamHandler) Handle(m interface{}) {
+	switch m := m.(type) {
+	case Tweet:
+		if h.OnTweet != nil {
+			h.OnTweet(m)
+		}
+	case StatusDeletionNotice:
+		if h.OnDelete != nil {
+			h.OnDelete(m)
+		}
+	case DirectMessageDeletionNotice:
+		if h.OnDirectMessageDelete != nil {
+			h.OnDirectMessageDelete(m)
+		}
+	case LocationDeletionNotice:
+		if h.OnScrubGeo != nil {
+			h.OnScrubGeo(m)
+		}
+	case LimitNotice:
+		if h.OnLimit != nil {
+			h.OnLimit(m)
+		}
+	case StatusWithheldNotice:
+		if h.OnStatusWithheld != nil {
+			h.OnStatusWithheld(m)
+		}
+	case UserWithheldNotice:
+		if h.OnUserWithheld != nil {
+			h.OnUserWithheld(m)
+		}
+	case DisconnectMessage:
+		if h.OnDisconnect != nil {
+			h.OnDisconnect(m)
+		}
+	case StallWarning:
+		if h.OnStallWarning != nil {
+			h.OnStallWarning(m)
+		}
+	case TooManyFollow:
+		if h.OnTooManyFollows != nil {
+			h.OnTooManyFollows(m)
+		}
+	case FriendsList:
+		if h.OnFriendsList != nil {
+			h.OnFriendsList(m)
+		}
+	case DirectMessage:
+		if h.OnDirectMessage != nil {
+			h.OnDirectMessage(m)
+		}
+	case EventTweet:
+		if h.OnEventTweet != nil {
+			h.OnEventTweet(m)
+		} else if h.OnEvent != nil {
+			h.OnEvent(m.Event)
+		}
+	case EventList:
+		if h.OnEventList != nil {
+			h.OnEventList(m)
+		} else if h.OnEvent != nil {
+			h.OnEvent(m.Event)
+		}
+	case Event:
+		if h.OnEvent != nil {
+			h.OnEvent(m)
+		}
+	case EventFollow:
+		if h.OnEvent != nil {
+			h.OnEvent(m.Event)
+		}
+	case UnknownMessage:
+		if h.OnUnknown != nil {
+			h.OnUnknown(m)
+		}
+	case StreamStatusEvent:
+		if h.OnStatus != nil {
+			h.OnStatus(m)
+		}
+	case StreamErrorEvent:
+		if h.OnError != nil {
+			h.OnError(m)
+		}
+	}
+}
+
+// Listen handles the messages of s until its channel is closed
+func (h *StreamHandler) Listen(s *Stream) {
+	for m := range s.C {
+		h.Handle(m)
+	}
+}
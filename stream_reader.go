@@ -0,0 +1,122 @@
+package anaconda
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+)
+
+// StreamMaxMessageSize is the default size in bytes over which a stream message is dropped,
+// see SetStreamMaxMessageSize
+const StreamMaxMessageSize = 1 << 20
+
+// streamMaxLengthSize bounds the length prefix of the messages of a stream requested with delimited=length
+const streamMaxLengthSize = 32
+
+// MessageTooLargeError is the error of the StreamErrorEvent of a message dropped because
+// it exceeds the maximum size, the stream carries on with the next message
+type MessageTooLargeError struct {
+	Size  int // as read, including the trailing new line of a line
+	Limit int
+}
+
+func (e *MessageTooLargeError) Error() string {
+	return fmt.Sprintf("anaconda: stream message of %d bytes dropped, the limit is %d bytes", e.Size, e.Limit)
+}
+
+// StreamErrorEvent reports a message of a Stream which could not be read,
+// such as a *MessageTooLargeError. The connection is kept open.
+type StreamErrorEvent struct {
+	Err error
+}
+
+func (StreamErrorEvent) streamMessage() {}
+
+// streamReader splits the body of a stream into messages: lines,
+// or messages prefixed by their length when the stream is requested with delimited=length
+type streamReader struct {
+	r         *bufio.Reader
+	delimited bool
+	max       int
+	buf       []byte
+}
+
+func newStreamReader(r io.Reader, delimited bool, max int) *streamReader {
+	return &streamReader{r: bufio.NewReader(r), delimited: delimited, max: max}
+}
+
+// next returns the next message, without its trailing new line. The message is only valid until the next call.
+// A keep-alive is returned as an empty message, in both framings.
+// A message over the maximum size is skipped and reported as a *MessageTooLargeError,
+// the reader can go on with the next one.
+func (s *streamReader) next() ([]byte, error) {
+	if !s.delimited {
+		return s.readLine(s.max)
+	}
+
+	line, err := s.readLine(streamMaxLengthSize)
+	if e, ok := err.(*MessageTooLargeError); ok {
+		return nil, fmt.Errorf("anaconda: invalid message length prefix of %d bytes", e.Size)
+	}
+	if err != nil || len(line) == 0 {
+		// a keep-alive when there is no length
+		return line, err
+	}
+	n, err := strconv.Atoi(string(line))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("anaconda: invalid message length %q", line)
+	}
+	if n > s.max {
+		if _, err := io.CopyN(ioutil.Discard, s.r, int64(n)); err != nil {
+			return nil, err
+		}
+		return nil, &MessageTooLargeError{Size: n, Limit: s.max}
+	}
+	if cap(s.buf) < n {
+		s.buf = make([]byte, n)
+	}
+	s.buf = s.buf[:n]
+	if _, err := io.ReadFull(s.r, s.buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return bytes.TrimRight(s.buf, "\r\n"), nil
+}
+
+// readLine returns the next line, or skips it if it is longer than max bytes.
+// A line without its new line at the end of the body is returned as io.ErrUnexpectedEOF.
+func (s *streamReader) readLine(max int) ([]byte, error) {
+	s.buf = s.buf[:0]
+	size := 0
+	for {
+		chunk, err := s.r.ReadSlice('\n')
+		size += len(chunk)
+		if size <= max+2 {
+			s.buf = append(s.buf, chunk...)
+		}
+		switch err {
+		case bufio.ErrBufferFull:
+			continue
+		case nil:
+		case io.EOF:
+			if size == 0 {
+				return nil, io.EOF
+			}
+			// a line cut by the end of the connection
+			return nil, io.ErrUnexpectedEOF
+		default:
+			return nil, err
+		}
+
+		line := bytes.TrimRight(s.buf, "\r\n")
+		if size > max+2 || len(line) > max {
+			return nil, &MessageTooLargeError{Size: size, Limit: max}
+		}
+		return line, nil
+	}
+}
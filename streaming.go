@@ -1,22 +1,44 @@
 package anaconda
 
 import (
-	"bufio"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/dustin/go-jsonpointer"
+	"github.com/azr/backoff"
 )
 
 const (
 	BaseUrlUserStream = "https://userstream.twitter.com/1.1"
 	BaseUrlSiteStream = "https://sitestream.twitter.com/1.1"
 	BaseUrlStream     = "https://stream.twitter.com/1.1"
+
+	// StreamIdleTimeout is the default time after which a stream receiving nothing,
+	// not even the keep-alive blank lines sent every 30 seconds, reconnects
+	StreamIdleTimeout = 90 * time.Second
 )
 
+// ErrStreamStalled is the error of the StreamStalled status events
+var ErrStreamStalled = errors.New("anaconda: stream stalled, no data received before the idle timeout")
+
+// ErrStreamEmpty is the error of the StreamReconnecting status events
+// after a connection closed by twitter before sending any data
+var ErrStreamEmpty = errors.New("anaconda: stream closed before sending any data")
+
+// streamTransport is the transport of the streams of the clients using the default transport.
+// It bounds the wait for the response headers but, unlike the default client, not the whole request.
+var streamTransport = func() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.ResponseHeaderTimeout = StreamIdleTimeout
+	return t
+}()
+
 // messages
 
 type StatusDeletionNotice struct {
@@ -25,11 +47,6 @@ type StatusDeletionNotice struct {
 	UserId    int64  `json:"user_id"`
 	UserIdStr string `json:"user_id_str"`
 }
-type statusDeletionNotice struct {
-	Delete *struct {
-		Status *StatusDeletionNotice `json:"status"`
-	} `json:"delete"`
-}
 
 type DirectMessageDeletionNotice struct {
 	Id        int64  `json:"id"`
@@ -38,72 +55,41 @@ type DirectMessageDeletionNotice struct {
 	UserIdStr string `json:"user_id_str"`
 }
 
-type directMessageDeletionNotice struct {
-	Delete *struct {
-		DirectMessage *DirectMessageDeletionNotice `json:"direct_message"`
-	} `json:"delete"`
-}
-
 type LocationDeletionNotice struct {
 	UserId          int64  `json:"user_id"`
 	UserIdStr       string `json:"user_id_str"`
 	UpToStatusId    int64  `json:"up_to_status_id"`
 	UpToStatusIdStr string `json:"up_to_status_id_str"`
 }
-type locationDeletionNotice struct {
-	ScrubGeo *LocationDeletionNotice `json:"scrub_geo"`
-}
 
 type LimitNotice struct {
 	Track int64 `json:"track"`
 }
-type limitNotice struct {
-	Limit *LimitNotice `json:"limit"`
-}
 
 type StatusWithheldNotice struct {
 	Id                  int64    `json:"id"`
 	UserId              int64    `json:"user_id"`
 	WithheldInCountries []string `json:"withheld_in_countries"`
 }
-type statusWithheldNotice struct {
-	StatusWithheld *StatusWithheldNotice `json:"status_withheld"`
-}
 
 type UserWithheldNotice struct {
 	Id                  int64    `json:"id"`
 	WithheldInCountries []string `json:"withheld_in_countries"`
 }
-type userWithheldNotice struct {
-	UserWithheld *UserWithheldNotice `json:"user_withheld"`
-}
 
 type DisconnectMessage struct {
 	Code       int64  `json:"code"`
 	StreamName string `json:"stream_name"`
 	Reason     string `json:"reason"`
 }
-type disconnectMessage struct {
-	Disconnect *DisconnectMessage `json:"disconnect"`
-}
 
 type StallWarning struct {
 	Code        string `json:"code"`
 	Message     string `json:"message"`
 	PercentFull int64  `json:"percent_full"`
 }
-type stallWarning struct {
-	Warning *StallWarning `json:"warning"`
-}
 
 type FriendsList []int64
-type friendsList struct {
-	Friends *FriendsList `json:"friends"`
-}
-
-type streamDirectMessage struct {
-	DirectMessage *DirectMessage `json:"direct_message"`
-}
 
 type Event struct {
 	Target    *User  `json:"target"`
@@ -141,178 +127,450 @@ type TooManyFollow struct {
 //
 // A go loop is started an gives you an stream that sends interface{}
 // objects through it's chan C
-// Objects which you can cast into a tweet like this :
+// Every object is a StreamMessage, which you can cast into a tweet like this :
 //    t, ok := o.(twitter.Tweet) // try casting into a tweet
 //    if !ok {
 //      log.Debug("Recieved non tweet message")
 //    }
+// or hand over to the callbacks of a StreamHandler.
+// Messages of an unknown type are sent as an UnknownMessage holding their JSON.
 //
 // If we can't stream the chan will be closed.
 // Otherwise the loop will connect and send streams in the chan.
-// It will also try to reconnect itself after an exponential backoff time
-// if the connection is lost
-// If twitter response is one of 420, 429 or 503 (meaning "wait a sec")
-// the loop retries to open the socket with a simple autogrowing backoff.
+// Once an established connection drops, the loop reconnects immediately.
+// If the reconnect fails, it backs off as documented by Twitter
+// (https://developer.twitter.com/en/docs/tutorials/consuming-streaming-data):
+// linearly after a network error, exponentially after an HTTP error such as 503,
+// and exponentially from a minute after being rate limited (420 or 429).
+// The loop gives up after an irremediable HTTP error such as 401 or 404.
+// Messages are split on new lines, or by their length when v sets delimited=length.
+// A message over 1MB (see SetStreamMaxMessageSize) is dropped and reported
+// as a StreamErrorEvent, the stream goes on with the next one.
+// A connection over which nothing, not even a keep-alive blank line, is received
+// for 90 seconds (see SetStreamIdleTimeout) is considered stalled and replaced.
+// Every connection, disconnection and reconnect attempt is sent in the chan
+// as a StreamStatusEvent.
 //
 // When finished streaming call stream.Stop() to initiate termination process.
+// Done is closed, after the chan, once the stream ended and Err tells why.
 //
 
 type Stream struct {
 	api TwitterApi
 	C   chan interface{}
-	run bool
+
+	// ctx is cancelled by Stop, it aborts the request, the back offs and the sends in C
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// delimited is set when the messages are prefixed by their length, see the delimited parameter
+	delimited bool
+
+	mu   sync.Mutex
+	body io.Closer // body of the current connection
+	err  error
 }
 
-func (s *Stream) listen(response http.Response) {
-	if response.Body != nil {
-		defer response.Body.Close()
+// ErrStreamStopped is the Err of a Stream ended by Stop
+var ErrStreamStopped = errors.New("anaconda: stream stopped")
+
+// StreamStatus is the state of the connection of a Stream
+type StreamStatus int
+
+const (
+	// StreamConnected is sent once the stream is connected and Twitter answered 200 OK
+	StreamConnected StreamStatus = iota
+	// StreamDisconnected is sent when an established connection drops, the stream reconnects immediately
+	StreamDisconnected
+	// StreamReconnecting is sent when a connection attempt failed, the stream backs off before reconnecting
+	StreamReconnecting
+	// StreamStalled is sent when nothing was received for the idle timeout, see SetStreamIdleTimeout.
+	// The stream drops the connection and reconnects immediately.
+	StreamStalled
+)
+
+func (s StreamStatus) String() string {
+	switch s {
+	case StreamConnected:
+		return "connected"
+	case StreamDisconnected:
+		return "disconnected"
+	case StreamReconnecting:
+		return "reconnecting"
+	case StreamStalled:
+		return "stalled"
 	}
+	return fmt.Sprintf("StreamStatus(%d)", int(s))
+}
+
+// StreamStatusEvent reports a change of the connection of a Stream
+type StreamStatusEvent struct {
+	Status StreamStatus
+
+	// Attempt counts the failed connection attempts since the last successful one
+	Attempt int
+
+	// StatusCode is the HTTP status of a failed connection attempt,
+	// Err the network error of a failed attempt or of a dropped connection
+	StatusCode int
+	Err        error
+}
+
+func (StreamStatusEvent) streamMessage() {}
+
+// streamBackoffs creates the back off strategies of a Stream, nil functions mean the default ones
+type streamBackoffs struct {
+	tcpip, http, http420 func() backoff.Interface
+}
+
+func newStreamBackoff(f func() backoff.Interface, def func() backoff.Interface) backoff.Interface {
+	if f == nil {
+		return def()
+	}
+	return f()
+}
+
+// idleReader closes the body of a stream when nothing is read from it for timeout
+type idleReader struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	stalled int32
+}
+
+func newIdleReader(body io.ReadCloser, timeout time.Duration) *idleReader {
+	r := &idleReader{body: body, timeout: timeout}
+	r.timer = time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&r.stalled, 1)
+		body.Close()
+	})
+	return r
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	return n, err
+}
+
+func (r *idleReader) Close() error {
+	r.timer.Stop()
+	return r.body.Close()
+}
+
+// Stalled reports whether the body was closed by the idle timeout
+func (r *idleReader) Stalled() bool {
+	return atomic.LoadInt32(&r.stalled) == 1
+}
+
+// listen sends the messages of the response until the connection drops,
+// it returns ErrStreamStalled when nothing was received for the idle timeout.
+// received reports whether a message or a keep-alive was read before.
+func (s *Stream) listen(response *http.Response) (received bool, err error) {
+	body := newIdleReader(response.Body, s.idleTimeout())
+	defer body.Close()
+	if !s.setBody(body) {
+		return false, ErrStreamStopped
+	}
+	defer s.setBody(nil)
 
 	s.api.Log.Notice("Listening to twitter socket")
 	defer s.api.Log.Notice("twitter socket closed, leaving loop")
 
-	scanner := bufio.NewScanner(response.Body)
+	reader := newStreamReader(body, s.delimited, s.maxMessageSize())
 
-	for scanner.Scan() && s.run {
-		j := scanner.Bytes()
+	for {
+		var j []byte
+		j, err = reader.next()
+		if tooLarge, ok := err.(*MessageTooLargeError); ok {
+			s.api.Log.Warningf("Twitter streaming: %s", tooLarge)
+			if !s.send(StreamErrorEvent{Err: tooLarge}) {
+				return received, ErrStreamStopped
+			}
+			continue
+		}
+		if err != nil {
+			break
+		}
+		received = true
 		if len(j) == 0 {
 			s.api.Log.Debug("Empty bytes... Moving along")
 		} else {
-			s.C <- jsonToKnownType(j)
+			m, err := DecodeStreamMessage(j)
+			if err != nil {
+				s.api.Log.Debugf("Cannot decode stream message: %s", err)
+			}
+			if !s.send(m) {
+				return received, ErrStreamStopped
+			}
 		}
 	}
+	if s.stopped() {
+		return received, ErrStreamStopped
+	}
+	if body.Stalled() {
+		return received, ErrStreamStalled
+	}
+	if err == io.EOF {
+		return received, nil
+	}
+	return received, err
 }
 
-func jsonToKnownType(j []byte) interface{} {
-	// TODO: DRY
-	if o := new(Tweet); jsonAsStruct(j, "/source", &o) {
-		return *o
-	} else if o := new(statusDeletionNotice); jsonAsStruct(j, "/delete/status", &o) {
-		return *o.Delete.Status
-	} else if o := new(directMessageDeletionNotice); jsonAsStruct(j, "/delete/direct_message", &o) {
-		return *o.Delete.DirectMessage
-	} else if o := new(locationDeletionNotice); jsonAsStruct(j, "/scrub_geo", &o) {
-		return *o.ScrubGeo
-	} else if o := new(limitNotice); jsonAsStruct(j, "/limit", &o) {
-		return *o.Limit
-	} else if o := new(statusWithheldNotice); jsonAsStruct(j, "/status_withheld", &o) {
-		return *o.StatusWithheld
-	} else if o := new(userWithheldNotice); jsonAsStruct(j, "/user_withheld", &o) {
-		return *o.UserWithheld
-	} else if o := new(disconnectMessage); jsonAsStruct(j, "/disconnect", &o) {
-		return *o.Disconnect
-	} else if o := new(stallWarning); jsonAsStruct(j, "/warning", &o) {
-		return *o.Warning
-	} else if o := new(friendsList); jsonAsStruct(j, "/friends", &o) {
-		return *o.Friends
-	} else if o := new(streamDirectMessage); jsonAsStruct(j, "/direct_message", &o) {
-		return *o.DirectMessage
-	} else if o := new(EventTweet); jsonAsStruct(j, "/target_object/source", &o) {
-		return *o
-	} else if o := new(EventList); jsonAsStruct(j, "/target_object/slug", &o) {
-		return *o
-	} else if o := new(Event); jsonAsStruct(j, "/target_object", &o) {
-		return *o
-	} else if o := new(EventFollow); jsonAsStruct(j, "/event", &o) {
-		return *o
-	} else {
-		return nil
+func (s *Stream) maxMessageSize() int {
+	if s.api.streamMaxMessageSize > 0 {
+		return s.api.streamMaxMessageSize
 	}
+	return StreamMaxMessageSize
+}
+
+func (s *Stream) idleTimeout() time.Duration {
+	if s.api.streamIdleTimeout > 0 {
+		return s.api.streamIdleTimeout
+	}
+	return StreamIdleTimeout
+}
+
+// httpClient returns the client of the API without its overall timeout, which would kill healthy streams
+func (s *Stream) httpClient() *http.Client {
+	client := *s.api.httpClient()
+	client.Timeout = 0
+	if client.Transport == nil {
+		client.Transport = streamTransport
+	}
+	return &client
 }
 
 func (s *Stream) requestStream(urlStr string, v url.Values, method int) (resp *http.Response, err error) {
+	var req *http.Request
 	switch method {
 	case _GET:
-		return s.api.oauthClient.Get(s.api.HttpClient, s.api.Credentials, urlStr, v)
+		req, err = s.api.newRequest(s.ctx, http.MethodGet, urlStr, v)
 	case _POST:
-		return s.api.oauthClient.Post(s.api.HttpClient, s.api.Credentials, urlStr, v)
+		req, err = s.api.newRequest(s.ctx, http.MethodPost, urlStr, v)
 	default:
+		return nil, fmt.Errorf("HTTP method not yet supported")
+	}
+	if err != nil {
+		return nil, err
 	}
-	return nil, fmt.Errorf("HTTP method not yet supported")
+	return s.httpClient().Do(req)
 }
 
 func (s *Stream) loop(urlStr string, v url.Values, method int) {
 	defer s.api.Log.Debug("Leaving request stream loop")
+	defer close(s.done)
 	defer close(s.C)
 
-	rlb := NewHTTP420ErrBackoff()
-	for s.run {
+	tcpipBackoff := newStreamBackoff(s.api.streamBackoffs.tcpip, NewTCPIPErrBackoff)
+	httpBackoff := newStreamBackoff(s.api.streamBackoffs.http, NewHTTPErrBackoff)
+	rlb := newStreamBackoff(s.api.streamBackoffs.http420, NewHTTP420ErrBackoff)
+	attempt := 0
+
+	for !s.stopped() {
 		resp, err := s.requestStream(urlStr, v, method)
 		if err != nil {
-			if err == io.EOF {
-				// Sometimes twitter closes the stream
-				// right away with EOF as of a rate limit
-				resp.StatusCode = 420
-			} else {
-				s.api.Log.Criticalf("Cannot request stream : %s", err)
-				return
+			if s.stopped() {
+				break
 			}
+			attempt++
+			// including an EOF, when twitter closes the connection right away
+			s.api.Log.Noticef("Twitter streaming: backing off after a network error: %s", err)
+			if s.send(StreamStatusEvent{Status: StreamReconnecting, Attempt: attempt, Err: err}) {
+				s.backOff(tcpipBackoff)
+			}
+			continue
 		}
 		s.api.Log.Debugf("Response status=%s code=%d", resp.Status, resp.StatusCode)
 
 		switch resp.StatusCode {
 		case 200, 304:
-			s.listen(*resp)
+			httpBackoff.Reset()
 			rlb.Reset()
-		case 420, 429, 503:
-			s.api.Log.Noticef("Twitter streaming: backing off as got : %+s", resp.Status)
-			rlb.BackOff()
-		case 400, 401, 403, 404, 406, 410, 422, 500, 502, 504:
+			if !s.send(StreamStatusEvent{Status: StreamConnected}) {
+				resp.Body.Close()
+				continue
+			}
+			received, err := s.listen(resp)
+			if received {
+				attempt = 0
+				tcpipBackoff.Reset()
+			}
+			switch err {
+			case ErrStreamStopped:
+				continue
+			case ErrStreamStalled:
+				s.api.Log.Notice("Twitter streaming: reconnecting a stalled stream")
+				s.send(StreamStatusEvent{Status: StreamStalled, Err: err})
+			default:
+				s.send(StreamStatusEvent{Status: StreamDisconnected, Err: err})
+			}
+			if !received {
+				// twitter closed the connection right away, do not reconnect in a hot loop
+				attempt++
+				if err == nil {
+					err = ErrStreamEmpty
+				}
+				s.api.Log.Noticef("Twitter streaming: backing off after a connection closed without data: %s", err)
+				if s.send(StreamStatusEvent{Status: StreamReconnecting, Attempt: attempt, Err: err}) {
+					s.backOff(tcpipBackoff)
+				}
+			}
+			continue
+		case 400, 401, 403, 404, 406, 410, 413, 416, 422:
 			s.api.Log.Criticalf("Twitter streaming: leaving after an irremediable error: %+s", resp.Status)
+			s.setErr(newApiError(resp, s.api.errorBodySize()))
+			resp.Body.Close()
 			return
+		}
+		resp.Body.Close()
+
+		attempt++
+		if !s.send(StreamStatusEvent{Status: StreamReconnecting, Attempt: attempt, StatusCode: resp.StatusCode}) {
+			continue
+		}
+		switch resp.StatusCode {
+		case 420, 429:
+			s.api.Log.Noticef("Twitter streaming: backing off as got : %+s", resp.Status)
+			s.backOff(rlb)
 		default:
-			s.api.Log.Notice("Received unknown status: %+s", resp.StatusCode)
+			s.api.Log.Noticef("Twitter streaming: backing off after an HTTP error: %+s", resp.Status)
+			s.backOff(httpBackoff)
 		}
+	}
+
+	// the context of the API, when it is done, or Stop
+	if err := s.api.Context().Err(); err != nil {
+		s.setErr(err)
+	}
+	s.setErr(ErrStreamStopped)
+}
+
+// stopped reports whether the stream was stopped, or its context is done
+func (s *Stream) stopped() bool {
+	return s.ctx.Err() != nil
+}
+
+// send sends m in C unless the stream is stopped first
+func (s *Stream) send(m interface{}) bool {
+	select {
+	case s.C <- m:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+// backOff waits for b unless the stream is stopped first
+func (s *Stream) backOff(b backoff.Interface) {
+	waited := make(chan struct{})
+	go func() {
+		b.BackOff()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-s.ctx.Done():
+	}
+}
+
+// setBody records the body of the current connection, so that Stop can close it.
+// It returns false if the stream is already stopped.
+func (s *Stream) setBody(body io.Closer) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.body = body
+	return !s.stopped()
+}
 
+// setErr records why the stream ended, only the first reason is kept
+func (s *Stream) setErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
 	}
 }
 
+// Stop ends the stream: the current connection is closed right away and C is closed
+// without waiting for the consumer to read pending messages. Stop may be called
+// several times and from any goroutine. Wait for Done to know the stream ended.
 func (s *Stream) Stop() {
-	s.run = false
+	s.setErr(ErrStreamStopped)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cancel()
+	if s.body != nil {
+		s.body.Close()
+	}
 }
 
-func (s *Stream) start(urlStr string, v url.Values, method int) {
-	s.run = true
-	go s.loop(urlStr, v, method)
+// Done returns a channel closed once the stream ended and C is closed
+func (s *Stream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err tells why the stream ended: ErrStreamStopped after Stop, the *ApiError of an irremediable
+// HTTP status such as 401 when the credentials are rejected, or the error of the context of the API.
+// Err returns nil while the stream is running.
+func (s *Stream) Err() error {
+	select {
+	case <-s.done:
+	default:
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
 }
 
 func (a TwitterApi) newStream(urlStr string, v url.Values, method int) *Stream {
-	stream := Stream{
-		api: a,
-		C:   make(chan interface{}),
+	ctx, cancel := context.WithCancel(a.Context())
+	stream := &Stream{
+		api:    a,
+		C:      make(chan interface{}),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+
+		delimited: v.Get("delimited") == "length",
 	}
 
-	stream.start(urlStr, v, method)
-	return &stream
+	go stream.loop(urlStr, v, method)
+	return stream
+}
+
+// streamURL returns the URL of a streaming endpoint, see SetStreamBaseUrl
+func (a TwitterApi) streamURL(baseUrl, path string) string {
+	if a.streamBaseUrl != "" {
+		baseUrl = a.streamBaseUrl
+	}
+	return baseUrl + path
 }
 
 func (a TwitterApi) UserStream(v url.Values) (stream *Stream) {
-	return a.newStream(BaseUrlUserStream+"/user.json", v, _GET)
+	return a.newStream(a.streamURL(BaseUrlUserStream, "/user.json"), v, _GET)
 }
 
 func (a TwitterApi) PublicStreamSample(v url.Values) (stream *Stream) {
-	return a.newStream(BaseUrlStream+"/statuses/sample.json", v, _GET)
+	return a.newStream(a.streamURL(BaseUrlStream, "/statuses/sample.json"), v, _GET)
 }
 
 // XXX: To use this API authority is requied. but I dont have this. I cant test.
 func (a TwitterApi) PublicStreamFirehose(v url.Values) (stream *Stream) {
-	return a.newStream(BaseUrlStream+"/statuses/firehose.json", v, _GET)
+	return a.newStream(a.streamURL(BaseUrlStream, "/statuses/firehose.json"), v, _GET)
 }
 
-// XXX: PublicStream(Track|Follow|Locations) func is needed?
+// PublicStreamFilter returns the public Tweets matching the track, follow and locations parameters of v,
+// see PublicStreamFilterParams for typed parameters and NewFilterStream for predicates changing over time
 func (a TwitterApi) PublicStreamFilter(v url.Values) (stream *Stream) {
-	return a.newStream(BaseUrlStream+"/statuses/filter.json", v, _POST)
+	return a.newStream(a.streamURL(BaseUrlStream, "/statuses/filter.json"), v, _POST)
 }
 
 // XXX: To use this API authority is requied. but I dont have this. I cant test.
 func (a TwitterApi) SiteStream(v url.Values) (stream *Stream) {
-	return a.newStream(BaseUrlSiteStream+"/site.json", v, _GET)
-}
-
-func jsonAsStruct(j []byte, path string, obj interface{}) (res bool) {
-	if v, _ := jsonpointer.Find(j, path); v == nil {
-		return false
-	}
-	err := json.Unmarshal(j, obj)
-	return err == nil
+	return a.newStream(a.streamURL(BaseUrlSiteStream, "/site.json"), v, _GET)
 }
@@ -0,0 +1,123 @@
+package anaconda
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/dustin/go-jsonpointer"
+)
+
+// The decoder of the stream messages replaced by DecodeStreamMessage,
+// kept to benchmark the latter against it
+
+type statusDeletionNotice struct {
+	Delete *struct {
+		Status *StatusDeletionNotice `json:"status"`
+	} `json:"delete"`
+}
+
+type directMessageDeletionNotice struct {
+	Delete *struct {
+		DirectMessage *DirectMessageDeletionNotice `json:"direct_message"`
+	} `json:"delete"`
+}
+
+type locationDeletionNotice struct {
+	ScrubGeo *LocationDeletionNotice `json:"scrub_geo"`
+}
+
+type limitNotice struct {
+	Limit *LimitNotice `json:"limit"`
+}
+
+type statusWithheldNotice struct {
+	StatusWithheld *StatusWithheldNotice `json:"status_withheld"`
+}
+
+type userWithheldNotice struct {
+	UserWithheld *UserWithheldNotice `json:"user_withheld"`
+}
+
+type disconnectMessage struct {
+	Disconnect *DisconnectMessage `json:"disconnect"`
+}
+
+type stallWarning struct {
+	Warning *StallWarning `json:"warning"`
+}
+
+type friendsList struct {
+	Friends *FriendsList `json:"friends"`
+}
+
+type streamDirectMessage struct {
+	DirectMessage *DirectMessage `json:"direct_message"`
+}
+
+func legacyJSONToKnownType(j []byte) interface{} {
+	// TODO: DRY
+	if o := new(Tweet); jsonAsStruct(j, "/source", &o) {
+		return *o
+	} else if o := new(statusDeletionNotice); jsonAsStruct(j, "/delete/status", &o) {
+		return *o.Delete.Status
+	} else if o := new(directMessageDeletionNotice); jsonAsStruct(j, "/delete/direct_message", &o) {
+		return *o.Delete.DirectMessage
+	} else if o := new(locationDeletionNotice); jsonAsStruct(j, "/scrub_geo", &o) {
+		return *o.ScrubGeo
+	} else if o := new(limitNotice); jsonAsStruct(j, "/limit", &o) {
+		return *o.Limit
+	} else if o := new(statusWithheldNotice); jsonAsStruct(j, "/status_withheld", &o) {
+		return *o.StatusWithheld
+	} else if o := new(userWithheldNotice); jsonAsStruct(j, "/user_withheld", &o) {
+		return *o.UserWithheld
+	} else if o := new(disconnectMessage); jsonAsStruct(j, "/disconnect", &o) {
+		return *o.Disconnect
+	} else if o := new(stallWarning); jsonAsStruct(j, "/warning", &o) {
+		return *o.Warning
+	} else if o := new(friendsList); jsonAsStruct(j, "/friends", &o) {
+		return *o.Friends
+	} else if o := new(streamDirectMessage); jsonAsStruct(j, "/direct_message", &o) {
+		return *o.DirectMessage
+	} else if o := new(EventTweet); jsonAsStruct(j, "/target_object/source", &o) {
+		return *o
+	} else if o := new(EventList); jsonAsStruct(j, "/target_object/slug", &o) {
+		return *o
+	} else if o := new(Event); jsonAsStruct(j, "/target_object", &o) {
+		return *o
+	} else if o := new(EventFollow); jsonAsStruct(j, "/event", &o) {
+		return *o
+	} else {
+		return nil
+	}
+}
+
+func jsonAsStruct(j []byte, path string, obj interface{}) (res bool) {
+	if v, _ := jsonpointer.Find(j, path); v == nil {
+		return false
+	}
+	err := json.Unmarshal(j, obj)
+	return err == nil
+}
+
+var benchStreamMessages = [][]byte{
+	[]byte(`{"created_at":"Wed Aug 27 13:08:45 +0000 2008","id":1050118621198921728,"id_str":"1050118621198921728","text":"To make room for more expression, we will now count all emojis as equal—including those with gender‍‍ and skin t… https:\/\/t.co\/MkGjXf9aXm","source":"<a href=\"http:\/\/twitter.com\" rel=\"nofollow\">Twitter Web Client<\/a>","truncated":true,"in_reply_to_status_id":null,"user":{"id":6253282,"id_str":"6253282","name":"Twitter API","screen_name":"TwitterAPI","location":"San Francisco, CA","url":"https:\/\/developer.twitter.com","description":"The Real Twitter API.","followers_count":6133636,"friends_count":12,"listed_count":12936,"created_at":"Wed May 23 06:01:13 +0000 2007","favourites_count":31,"verified":true,"statuses_count":3656,"lang":"en"},"geo":null,"coordinates":null,"place":null,"is_quote_status":false,"quote_count":0,"reply_count":0,"retweet_count":0,"favorite_count":0,"entities":{"hashtags":[],"urls":[{"url":"https:\/\/t.co\/MkGjXf9aXm","expanded_url":"https:\/\/twitter.com\/i\/web\/status\/1050118621198921728","display_url":"twitter.com\/i\/web\/status\/1…","indices":[117,140]}],"user_mentions":[],"symbols":[]},"favorited":false,"retweeted":false,"filter_level":"low","lang":"en","timestamp_ms":"1539269325000"}`),
+	[]byte(`{"delete":{"status":{"id":1234,"id_str":"1234","user_id":3,"user_id_str":"3"}}}`),
+	[]byte(`{"limit":{"track":1234}}`),
+	[]byte(`{"scrub_geo":{"user_id":14090452,"user_id_str":"14090452","up_to_status_id":23260136625,"up_to_status_id_str":"23260136625"}}`),
+}
+
+func BenchmarkLegacyJSONToKnownType(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		for _, j := range benchStreamMessages {
+			legacyJSONToKnownType(j)
+		}
+	}
+}
+
+func BenchmarkDecodeStreamMessage(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		for _, j := range benchStreamMessages {
+			DecodeStreamMessage(j)
+		}
+	}
+}
@@ -0,0 +1,512 @@
+package anaconda_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ChimeraCoder/anaconda"
+	"github.com/azr/backoff"
+)
+
+func Test_DecodeStreamMessage(t *testing.T) {
+	tests := []struct {
+		json     string
+		expected anaconda.StreamMessage
+	}{
+		{`{"delete": {"status": {"id": 1234, "id_str": "1234", "user_id": 3, "user_id_str": "3"}}}`,
+			anaconda.StatusDeletionNotice{Id: 1234, IdStr: "1234", UserId: 3, UserIdStr: "3"}},
+		{`{"delete": {"direct_message": {"id": 1234, "id_str": "1234", "user_id": 3, "user_id_str": "3"}}}`,
+			anaconda.DirectMessageDeletionNotice{Id: 1234, IdStr: "1234", UserId: 3, UserIdStr: "3"}},
+		{`{"scrub_geo": {"user_id": 14090452, "up_to_status_id": 23260136625}}`,
+			anaconda.LocationDeletionNotice{UserId: 14090452, UpToStatusId: 23260136625}},
+		{`{"limit": {"track": 1234}}`, anaconda.LimitNotice{Track: 1234}},
+		{`{"status_withheld": {"id": 1234, "user_id": 123, "withheld_in_countries": ["DE"]}}`,
+			anaconda.StatusWithheldNotice{Id: 1234, UserId: 123, WithheldInCountries: []string{"DE"}}},
+		{`{"user_withheld": {"id": 123, "withheld_in_countries": ["DE"]}}`,
+			anaconda.UserWithheldNotice{Id: 123, WithheldInCountries: []string{"DE"}}},
+		{`{"disconnect": {"code": 4, "stream_name": "filter", "reason": "duplicate stream"}}`,
+			anaconda.DisconnectMessage{Code: 4, StreamName: "filter", Reason: "duplicate stream"}},
+		{`{"warning": {"code": "FALLING_BEHIND", "message": "Your connection is falling behind", "percent_full": 60}}`,
+			anaconda.StallWarning{Code: "FALLING_BEHIND", Message: "Your connection is falling behind", PercentFull: 60}},
+		{`{"friends": [1, 2, 3]}`, anaconda.FriendsList{1, 2, 3}},
+		{`{"direct_message": {"id": 5, "id_str": "5", "text": "hi"}}`, anaconda.DirectMessage{Id: 5, IdStr: "5", Text: "hi"}},
+		{`{"target": {"screen_name": "dst"}, "source": {"screen_name": "src"}, "event": "follow"}`,
+			anaconda.EventFollow{anaconda.Event{Target: &anaconda.User{ScreenName: "dst"}, Source: &anaconda.User{ScreenName: "src"}, Event: "follow"}}},
+		{`{"unknown": {"field": 1}}`, anaconda.UnknownMessage(`{"unknown": {"field": 1}}`)},
+	}
+
+	for _, test := range tests {
+		m, err := anaconda.DecodeStreamMessage([]byte(test.json))
+		if err != nil {
+			t.Errorf("Cannot decode %s: %s", test.json, err)
+			continue
+		}
+		if !reflect.DeepEqual(m, test.expected) {
+			t.Errorf("Decoded %s to %#v, expected %#v", test.json, m, test.expected)
+		}
+	}
+
+	m, _ := anaconda.DecodeStreamMessage([]byte(`{"created_at": "Wed Aug 27 13:08:45 +0000 2008", "id": 1, "id_str": "1", "text": "hello", "source": "web"}`))
+	if tweet, ok := m.(anaconda.Tweet); !ok || tweet.IdStr != "1" || tweet.Text != "hello" || tweet.Source != "web" {
+		t.Errorf("Expected a tweet, received %#v", m)
+	}
+
+	m, _ = anaconda.DecodeStreamMessage([]byte(`{"warning": {"code": "FOLLOWS_OVER_LIMIT", "message": "...", "user_id": 13}}`))
+	if w, ok := m.(anaconda.TooManyFollow); !ok || w.Warning.UserId != 13 {
+		t.Errorf("Expected a TooManyFollow warning, received %#v", m)
+	}
+
+	m, _ = anaconda.DecodeStreamMessage([]byte(`{"event": "favorite", "source": {"screen_name": "src"}, "target_object": {"id_str": "2", "source": "web"}}`))
+	if e, ok := m.(anaconda.EventTweet); !ok || e.Event.Event != "favorite" || e.TargetObject.IdStr != "2" {
+		t.Errorf("Expected a tweet event, received %#v", m)
+	}
+
+	m, _ = anaconda.DecodeStreamMessage([]byte(`{"event": "list_created", "target_object": {"slug": "gophers"}}`))
+	if e, ok := m.(anaconda.EventList); !ok || e.TargetObject.Slug != "gophers" {
+		t.Errorf("Expected a list event, received %#v", m)
+	}
+
+	m, _ = anaconda.DecodeStreamMessage([]byte(`{"id_str": "3", "text": "short", "truncated": true, "extended_tweet": {"full_text": "long text"}}`))
+	if tweet, ok := m.(anaconda.Tweet); !ok || tweet.FullText != "long text" {
+		t.Errorf("Expected the extended tweet to be extracted, received %#v", m)
+	}
+
+	if m, err := anaconda.DecodeStreamMessage([]byte(`[1, 2]`)); err == nil || !reflect.DeepEqual(m, anaconda.UnknownMessage(`[1, 2]`)) {
+		t.Errorf("Expected an error and the raw message, received %#v, %v", m, err)
+	}
+
+	malformed := []byte(`{"limit": {"track": `)
+	m, err := anaconda.DecodeStreamMessage(malformed)
+	if err == nil || !reflect.DeepEqual(m, anaconda.UnknownMessage(malformed)) {
+		t.Errorf("Expected an error and the raw message, received %#v, %v", m, err)
+	}
+}
+
+func Test_StreamHandler(t *testing.T) {
+	var received []string
+	h := anaconda.StreamHandler{
+		OnTweet:   func(tweet anaconda.Tweet) { received = append(received, "tweet "+tweet.IdStr) },
+		OnLimit:   func(n anaconda.LimitNotice) { received = append(received, "limit") },
+		OnEvent:   func(e anaconda.Event) { received = append(received, "event "+e.Event) },
+		OnUnknown: func(m anaconda.UnknownMessage) { received = append(received, "unknown "+string(m)) },
+	}
+
+	for _, j := range []string{
+		`{"id_str": "1", "text": "hello"}`,
+		`{"limit": {"track": 1}}`,
+		`{"delete": {"status": {"id_str": "1"}}}`,
+		`{"event": "favorite", "target_object": {"id_str": "2", "source": "web"}}`,
+		`{"event": "follow"}`,
+		`{"what": 1}`,
+	} {
+		m, _ := anaconda.DecodeStreamMessage([]byte(j))
+		h.Handle(m)
+	}
+
+	expected := []string{"tweet 1", "limit", "event favorite", "event follow", `unknown {"what": 1}`}
+	if !reflect.DeepEqual(received, expected) {
+		t.Fatalf("Received %q, expected %q", received, expected)
+	}
+}
+
+// countingBackoff counts the back offs of a stream without sleeping
+type countingBackoff struct {
+	backoffs, resets int
+}
+
+func (b *countingBackoff) BackOff() { b.backoffs++ }
+func (b *countingBackoff) Reset()   { b.resets++ }
+
+// newFakeStream starts a stream whose successive connections are answered by the handlers of script
+func newFakeStream(t *testing.T, script []http.HandlerFunc) (*anaconda.TwitterApi, func() int) {
+	var mu sync.Mutex
+	connections := 0
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		i := connections
+		connections++
+		mu.Unlock()
+		if i >= len(script) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		script[i](w, r)
+	}))
+	// one connection per request, so that net/http does not retry a request on a dropped connection
+	server.Config.SetKeepAlivesEnabled(false)
+	server.Start()
+	t.Cleanup(server.Close)
+
+	api := anaconda.NewTwitterApiWithCredentials("", "", "", "")
+	api.SetStreamBaseUrl(server.URL)
+	t.Cleanup(api.Close)
+	return api, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return connections
+	}
+}
+
+// streamTweet writes a tweet and ends the response, dropping the connection
+func streamTweet(id string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id_str": "` + id + `", "text": "hello"}` + "\r\n"))
+	}
+}
+
+func streamStatus(code int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+	}
+}
+
+// streamNetworkError closes the connection without answering
+func streamNetworkError(w http.ResponseWriter, r *http.Request) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		panic(err)
+	}
+	conn.Close()
+}
+
+func Test_Stream_Reconnect(t *testing.T) {
+	api, connections := newFakeStream(t, []http.HandlerFunc{
+		streamTweet("1"),
+		streamStatus(http.StatusServiceUnavailable),
+		streamStatus(420),
+		streamNetworkError,
+		streamStatus(http.StatusInternalServerError),
+		streamTweet("2"),
+	})
+	tcpip, httpErr, http420 := &countingBackoff{}, &countingBackoff{}, &countingBackoff{}
+	api.SetStreamBackoffs(
+		func() backoff.Interface { return tcpip },
+		func() backoff.Interface { return httpErr },
+		func() backoff.Interface { return http420 },
+	)
+
+	var received []string
+	for m := range api.PublicStreamSample(nil).C {
+		switch m := m.(type) {
+		case anaconda.Tweet:
+			received = append(received, "tweet "+m.IdStr)
+		case anaconda.StreamStatusEvent:
+			s := fmt.Sprintf("%s %d", m.Status, m.Attempt)
+			if m.StatusCode != 0 {
+				s += fmt.Sprintf(" %d", m.StatusCode)
+			}
+			if m.Status == anaconda.StreamReconnecting && m.StatusCode == 0 && m.Err == nil {
+				t.Errorf("Expected the cause of a reconnect attempt, received %+v", m)
+			}
+			received = append(received, s)
+		default:
+			t.Errorf("Unexpected message %#v", m)
+		}
+	}
+
+	expected := []string{
+		"connected 0", "tweet 1", "disconnected 0",
+		"reconnecting 1 503",
+		"reconnecting 2 420",
+		"reconnecting 3",
+		"reconnecting 4 500",
+		"connected 0", "tweet 2", "disconnected 0",
+	}
+	if !reflect.DeepEqual(received, expected) {
+		t.Fatalf("Received\n%q\nexpected\n%q", received, expected)
+	}
+	if n := connections(); n != 7 {
+		t.Errorf("Expected 7 connections, the last one unauthorized, received %d", n)
+	}
+	if tcpip.backoffs != 1 || httpErr.backoffs != 2 || http420.backoffs != 1 {
+		t.Errorf("Unexpected back offs: tcpip=%d http=%d http420=%d", tcpip.backoffs, httpErr.backoffs, http420.backoffs)
+	}
+	if tcpip.resets != 2 || httpErr.resets != 2 || http420.resets != 2 {
+		t.Errorf("Expected the back offs to be reset on every connection: tcpip=%d http=%d http420=%d", tcpip.resets, httpErr.resets, http420.resets)
+	}
+}
+
+// streamEmpty answers 200 and closes the connection without sending anything
+func streamEmpty(w http.ResponseWriter, r *http.Request) {}
+
+func Test_Stream_ImmediateEOF(t *testing.T) {
+	api, connections := newFakeStream(t, []http.HandlerFunc{
+		streamEmpty,
+		streamEmpty,
+		streamTweet("1"),
+	})
+	tcpip, httpErr, http420 := &countingBackoff{}, &countingBackoff{}, &countingBackoff{}
+	api.SetStreamBackoffs(
+		func() backoff.Interface { return tcpip },
+		func() backoff.Interface { return httpErr },
+		func() backoff.Interface { return http420 },
+	)
+
+	var received []string
+	for m := range api.PublicStreamSample(nil).C {
+		switch m := m.(type) {
+		case anaconda.Tweet:
+			received = append(received, "tweet "+m.IdStr)
+		case anaconda.StreamStatusEvent:
+			if m.Status == anaconda.StreamReconnecting && m.Err != anaconda.ErrStreamEmpty {
+				t.Errorf("Expected ErrStreamEmpty as the cause of the reconnect attempt, received %+v", m)
+			}
+			received = append(received, fmt.Sprintf("%s %d", m.Status, m.Attempt))
+		}
+	}
+
+	expected := []string{
+		"connected 0", "disconnected 0", "reconnecting 1",
+		"connected 0", "disconnected 0", "reconnecting 2",
+		"connected 0", "tweet 1", "disconnected 0",
+	}
+	if !reflect.DeepEqual(received, expected) {
+		t.Fatalf("Received\n%q\nexpected\n%q", received, expected)
+	}
+	if n := connections(); n != 4 {
+		t.Errorf("Expected 4 connections, the last one unauthorized, received %d", n)
+	}
+	if tcpip.backoffs != 2 || tcpip.resets != 1 {
+		t.Errorf("Expected a tcp/ip back off after every empty connection: backoffs=%d resets=%d", tcpip.backoffs, tcpip.resets)
+	}
+}
+
+func Test_Stream_KeepAliveOnly(t *testing.T) {
+	for _, v := range []url.Values{nil, {"delimited": {"length"}}} {
+		api, _ := newFakeStream(t, []http.HandlerFunc{func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("\r\n\r\n"))
+		}})
+		tcpip := &countingBackoff{}
+		api.SetStreamBackoffs(func() backoff.Interface { return tcpip }, nil, nil)
+
+		for m := range api.PublicStreamFilter(v).C {
+			if e, ok := m.(anaconda.StreamStatusEvent); ok && e.Status == anaconda.StreamReconnecting {
+				t.Errorf("%v: expected the keep-alives to count as data, received %+v", v, e)
+			}
+		}
+		if tcpip.backoffs != 0 {
+			t.Errorf("%v: unexpected tcp/ip back offs %d", v, tcpip.backoffs)
+		}
+	}
+}
+
+func Test_Stream_TruncatedLine(t *testing.T) {
+	api, _ := newFakeStream(t, []http.HandlerFunc{func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id_str": "1", "text": "hello"}` + "\r\n" + `{"id_str": "2", "te`))
+	}})
+
+	var received []string
+	for m := range api.PublicStreamSample(nil).C {
+		switch m := m.(type) {
+		case anaconda.Tweet:
+			received = append(received, "tweet "+m.IdStr)
+		case anaconda.StreamStatusEvent:
+			if m.Status == anaconda.StreamDisconnected && m.Err != io.ErrUnexpectedEOF {
+				t.Errorf("Expected the truncated line to be reported as io.ErrUnexpectedEOF, received %v", m.Err)
+			}
+			received = append(received, m.Status.String())
+		default:
+			t.Errorf("Unexpected message %#v", m)
+		}
+	}
+	if expected := []string{"connected", "tweet 1", "disconnected"}; !reflect.DeepEqual(received, expected) {
+		t.Fatalf("Received %q, expected %q", received, expected)
+	}
+}
+
+// streamStall writes a stall warning then nothing until the client hangs up
+func streamStall(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(`{"warning": {"code": "FALLING_BEHIND", "message": "Your connection is falling behind", "percent_full": 60}}` + "\r\n"))
+	w.(http.Flusher).Flush()
+	select {
+	case <-r.Context().Done():
+	case <-time.After(10 * time.Second):
+	}
+}
+
+// streamKeepAlive writes keep-alive blank lines for d, then a tweet
+func streamKeepAlive(d time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for end := time.Now().Add(d); time.Now().Before(end); time.Sleep(20 * time.Millisecond) {
+			w.Write([]byte("\r\n"))
+			w.(http.Flusher).Flush()
+		}
+		w.Write([]byte(`{"id_str": "1", "text": "hello"}` + "\r\n"))
+	}
+}
+
+func Test_Stream_Stall(t *testing.T) {
+	api, _ := newFakeStream(t, []http.HandlerFunc{
+		streamStall,
+		streamKeepAlive(300 * time.Millisecond),
+	})
+	api.SetStreamIdleTimeout(100 * time.Millisecond)
+	// streams must not be bound by the overall timeout of the client
+	api.HttpClient = &http.Client{Timeout: 50 * time.Millisecond}
+
+	var received []string
+	h := anaconda.StreamHandler{
+		OnTweet: func(tweet anaconda.Tweet) { received = append(received, "tweet "+tweet.IdStr) },
+		OnStallWarning: func(w anaconda.StallWarning) {
+			received = append(received, fmt.Sprintf("warning %d%%", w.PercentFull))
+		},
+		OnStatus: func(e anaconda.StreamStatusEvent) {
+			if e.Status == anaconda.StreamStalled && e.Err != anaconda.ErrStreamStalled {
+				t.Errorf("Expected ErrStreamStalled, received %v", e.Err)
+			}
+			received = append(received, e.Status.String())
+		},
+	}
+	start := time.Now()
+	h.Listen(api.PublicStreamSample(nil))
+
+	expected := []string{"connected", "warning 60%", "stalled", "connected", "tweet 1", "disconnected"}
+	if !reflect.DeepEqual(received, expected) {
+		t.Fatalf("Received\n%q\nexpected\n%q", received, expected)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("The stalled connection was dropped after %s", elapsed)
+	}
+}
+
+// streamForever writes tweets until the client hangs up
+func streamForever(w http.ResponseWriter, r *http.Request) {
+	for i := 0; r.Context().Err() == nil; i++ {
+		if _, err := fmt.Fprintf(w, `{"id_str": "%d", "text": "hello"}`+"\r\n", i); err != nil {
+			return
+		}
+		w.(http.Flusher).Flush()
+	}
+}
+
+// waitDone fails the test unless s ends within a second
+func waitDone(t *testing.T, s *anaconda.Stream) {
+	t.Helper()
+	select {
+	case <-s.Done():
+	case <-time.After(time.Second):
+		t.Fatal("The stream did not end")
+	}
+	// C is closed before Done
+	for range s.C {
+	}
+}
+
+func Test_Stream_Stop(t *testing.T) {
+	slowBackoff := func() backoff.Interface { return backoff.NewConstant(time.Minute) }
+
+	tests := []struct {
+		name   string
+		script []http.HandlerFunc
+		// read is the number of messages read before Stop
+		read int
+	}{
+		// the consumer stops reading while the stream has messages to send
+		{"pending send", []http.HandlerFunc{streamForever}, 3},
+		// nothing to read, the stream is blocked reading the connection
+		{"idle connection", []http.HandlerFunc{streamStall}, 2},
+		// the stream is backing off after a 503
+		{"back off", []http.HandlerFunc{streamStatus(http.StatusServiceUnavailable)}, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api, _ := newFakeStream(t, test.script)
+			api.SetStreamBackoffs(slowBackoff, slowBackoff, slowBackoff)
+			s := api.PublicStreamSample(nil)
+
+			if err := s.Err(); err != nil {
+				t.Errorf("Expected no error while the stream runs, received %v", err)
+			}
+			for i := 0; i < test.read; i++ {
+				<-s.C
+			}
+			s.Stop()
+			waitDone(t, s)
+			s.Stop()
+
+			if err := s.Err(); err != anaconda.ErrStreamStopped {
+				t.Errorf("Expected ErrStreamStopped, received %v", err)
+			}
+		})
+	}
+}
+
+func Test_Stream_Err(t *testing.T) {
+	api, _ := newFakeStream(t, nil)
+	s := api.PublicStreamSample(nil)
+	waitDone(t, s)
+
+	apiErr, ok := s.Err().(*anaconda.ApiError)
+	if !ok || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected the ApiError of a 401, received %#v", s.Err())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	api, _ = newFakeStream(t, []http.HandlerFunc{streamStall})
+	s = api.WithContext(ctx).PublicStreamSample(nil)
+	<-s.C
+	cancel()
+	waitDone(t, s)
+	if err := s.Err(); err != context.Canceled {
+		t.Fatalf("Expected the error of the context, received %v", err)
+	}
+}
+
+func Test_Stream_Framing(t *testing.T) {
+	big := `{"id_str": "2", "text": "` + strings.Repeat("a", 100*1024) + `"}`
+	tooBig := `{"id_str": "3", "text": "` + strings.Repeat("b", 300*1024) + `"}`
+	messages := []string{`{"id_str": "1", "text": "hello"}`, big, tooBig, `{"id_str": "4", "text": "hello"}`}
+
+	tests := []struct {
+		name  string
+		v     url.Values
+		write func(w http.ResponseWriter, m string)
+	}{
+		{"newline", nil, func(w http.ResponseWriter, m string) {
+			fmt.Fprint(w, m+"\r\n\r\n")
+		}},
+		{"length", url.Values{"delimited": {"length"}}, func(w http.ResponseWriter, m string) {
+			fmt.Fprintf(w, "\r\n%d\r\n%s\r\n", len(m)+2, m)
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api, _ := newFakeStream(t, []http.HandlerFunc{func(w http.ResponseWriter, r *http.Request) {
+				for _, m := range messages {
+					test.write(w, m)
+				}
+			}})
+			api.SetStreamMaxMessageSize(200 * 1024)
+
+			var received []string
+			for m := range api.PublicStreamFilter(test.v).C {
+				switch m := m.(type) {
+				case anaconda.Tweet:
+					received = append(received, fmt.Sprintf("tweet %s %d", m.IdStr, len(m.Text)))
+				case anaconda.StreamErrorEvent:
+					e, ok := m.Err.(*anaconda.MessageTooLargeError)
+					if !ok || e.Limit != 200*1024 || e.Size < len(tooBig) {
+						t.Errorf("Unexpected error %v", m.Err)
+					}
+					received = append(received, "too large")
+				case anaconda.UnknownMessage:
+					t.Errorf("Unexpected message %s", m)
+				}
+			}
+
+			expected := []string{"tweet 1 5", fmt.Sprintf("tweet 2 %d", 100*1024), "too large", "tweet 4 5"}
+			if !reflect.DeepEqual(received, expected) {
+				t.Fatalf("Received %q, expected %q", received, expected)
+			}
+		})
+	}
+}
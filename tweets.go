@@ -10,9 +10,8 @@ func (a TwitterApi) GetTweet(id int64, v url.Values) (tweet Tweet, err error) {
 	v = cleanValues(v)
 	v.Set("id", strconv.FormatInt(id, 10))
 
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/statuses/show.json", v, &tweet, _GET, response_ch}
-	return tweet, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/statuses/show.json", v, &tweet, _GET)
+	return tweet, err
 }
 
 func (a TwitterApi) GetTweetsLookupByIds(ids []int64, v url.Values) (tweet []Tweet, err error) {
@@ -25,24 +24,21 @@ func (a TwitterApi) GetTweetsLookupByIds(ids []int64, v url.Values) (tweet []Twe
 	}
 	v = cleanValues(v)
 	v.Set("id", pids)
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/statuses/lookup.json", v, &tweet, _GET, response_ch}
-	return tweet, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/statuses/lookup.json", v, &tweet, _GET)
+	return tweet, err
 }
 
 func (a TwitterApi) GetRetweets(id int64, v url.Values) (tweets []Tweet, err error) {
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + fmt.Sprintf("/statuses/retweets/%d.json", id), v, &tweets, _GET, response_ch}
-	return tweets, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+fmt.Sprintf("/statuses/retweets/%d.json", id), v, &tweets, _GET)
+	return tweets, err
 }
 
 //PostTweet will create a tweet with the specified status message
 func (a TwitterApi) PostTweet(status string, v url.Values) (tweet Tweet, err error) {
 	v = cleanValues(v)
 	v.Set("status", status)
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/statuses/update.json", v, &tweet, _POST, response_ch}
-	return tweet, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/statuses/update.json", v, &tweet, _POST)
+	return tweet, err
 }
 
 //DeleteTweet will destroy (delete) the status (tweet) with the specified ID, assuming that the authenticated user is the author of the status (tweet).
@@ -52,9 +48,8 @@ func (a TwitterApi) DeleteTweet(id int64, trimUser bool) (tweet Tweet, err error
 	if trimUser {
 		v.Set("trim_user", "t")
 	}
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + fmt.Sprintf("/statuses/destroy/%d.json", id), v, &tweet, _POST, response_ch}
-	return tweet, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+fmt.Sprintf("/statuses/destroy/%d.json", id), v, &tweet, _POST)
+	return tweet, err
 }
 
 //Retweet will retweet the status (tweet) with the specified ID.
@@ -64,9 +59,8 @@ func (a TwitterApi) Retweet(id int64, trimUser bool) (rt Tweet, err error) {
 	if trimUser {
 		v.Set("trim_user", "t")
 	}
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + fmt.Sprintf("/statuses/retweet/%d.json", id), v, &rt, _POST, response_ch}
-	return rt, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+fmt.Sprintf("/statuses/retweet/%d.json", id), v, &rt, _POST)
+	return rt, err
 }
 
 //UnRetweet will renove retweet Untweets a retweeted status.
@@ -80,9 +74,8 @@ func (a TwitterApi) UnRetweet(id int64, trimUser bool) (rt Tweet, err error) {
 	if trimUser {
 		v.Set("trim_user", "t")
 	}
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + fmt.Sprintf("/statuses/unretweet/%d.json", id), v, &rt, _POST, response_ch}
-	return rt, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+fmt.Sprintf("/statuses/unretweet/%d.json", id), v, &rt, _POST)
+	return rt, err
 }
 
 // Favorite will favorite the status (tweet) with the specified ID.
@@ -90,9 +83,8 @@ func (a TwitterApi) UnRetweet(id int64, trimUser bool) (rt Tweet, err error) {
 func (a TwitterApi) Favorite(id int64) (rt Tweet, err error) {
 	v := url.Values{}
 	v.Set("id", fmt.Sprint(id))
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + fmt.Sprintf("/favorites/create.json"), v, &rt, _POST, response_ch}
-	return rt, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+fmt.Sprintf("/favorites/create.json"), v, &rt, _POST)
+	return rt, err
 }
 
 // Un-favorites the status specified in the ID parameter as the authenticating user.
@@ -101,7 +93,6 @@ func (a TwitterApi) Favorite(id int64) (rt Tweet, err error) {
 func (a TwitterApi) Unfavorite(id int64) (rt Tweet, err error) {
 	v := url.Values{}
 	v.Set("id", fmt.Sprint(id))
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + fmt.Sprintf("/favorites/destroy.json"), v, &rt, _POST, response_ch}
-	return rt, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+fmt.Sprintf("/favorites/destroy.json"), v, &rt, _POST)
+	return rt, err
 }
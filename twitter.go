@@ -28,6 +28,13 @@
 //  v.Set("count", "30")
 //  result, err := api.GetSearch("golang", v)
 //
+//Queries block until Twitter answers, which may include waiting for a rate limit window to reset.
+//To bound that wait, bind the endpoints to a context with WithContext.
+//
+//  ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+//  defer cancel()
+//  result, err := api.WithContext(ctx).GetSearch("golang", v)
+//
 //
 //Endpoints
 //
@@ -40,28 +47,37 @@
 package anaconda
 
 import (
+	"bytes"
+	"compress/gzip"
 	"compress/zlib"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/ChimeraCoder/tokenbucket"
+	"github.com/azr/backoff"
 	"github.com/garyburd/go-oauth/oauth"
 )
 
 const (
-	_GET          = iota
-	_POST         = iota
-	_DELETE       = iota
-	_PUT          = iota
-	ClientTimeout = 20
-	BaseUrlV1     = "https://api.twitter.com/1"
-	BaseUrl       = "https://api.twitter.com/1.1"
-	UploadBaseUrl = "https://upload.twitter.com/1.1"
+	_GET            = iota
+	_POST           = iota
+	_DELETE         = iota
+	_PUT            = iota
+	_POST_JSON      = iota
+	_POST_MULTIPART = iota
+	ClientTimeout   = 20
+	BaseUrlV1       = "https://api.twitter.com/1"
+	BaseUrl         = "https://api.twitter.com/1.1"
+	UploadBaseUrl   = "https://upload.twitter.com/1.1"
 )
 
 var (
@@ -72,7 +88,10 @@ var (
 type TwitterApi struct {
 	oauthClient          oauth.Client
 	Credentials          *oauth.Credentials
+	bearer               *bearerAuth // application-only authentication, see NewTwitterApiAppOnly
 	queryQueue           chan query
+	pool                 *queryPool
+	rateLimits           *rateLimitRegistry
 	bucket               *tokenbucket.Bucket
 	returnRateLimitError bool
 	HttpClient           *http.Client
@@ -85,14 +104,53 @@ type TwitterApi struct {
 	// used for testing
 	// defaults to BaseUrl
 	baseUrl string
+
+	// replaces UploadBaseUrl when set
+	uploadBaseUrl string
+
+	// used for testing
+	// replaces BaseUrlStream, BaseUrlUserStream and BaseUrlSiteStream when set
+	streamBaseUrl string
+
+	// back off strategies of the streams, see SetStreamBackoffs
+	streamBackoffs streamBackoffs
+
+	// streams reconnect after receiving nothing for streamIdleTimeout
+	// defaults to StreamIdleTimeout
+	streamIdleTimeout time.Duration
+
+	// holds back the queries of the endpoint families out of calls, see SetRateLimiter
+	rateLimiter RateLimiter
+
+	// decides whether the failed queries are retried, see SetRetryPolicy
+	retryPolicy *RetryPolicy
+
+	// stream messages over streamMaxMessageSize bytes are dropped
+	// defaults to StreamMaxMessageSize
+	streamMaxMessageSize int
+
+	// at most maxErrorBodySize bytes of the body of an error response are read
+	// defaults to DefaultMaxErrorBodySize
+	maxErrorBodySize int64
+
+	// wrap the sending of the signed requests, see Use
+	middlewares []Middleware
+
+	// ctx is attached to every query issued through this value of the struct
+	// nil means context.Background(), see WithContext
+	ctx context.Context
 }
 
 type query struct {
 	url         string
 	form        url.Values
+	body        []byte // JSON payload of _POST_JSON queries, multipart payload of _POST_MULTIPART queries
+	contentType string // of the multipart payload
 	data        interface{}
 	method      int
 	response_ch chan response
+	ctx         context.Context
+	resource    string // endpoint family, see rateLimitResource
 }
 
 type response struct {
@@ -103,6 +161,9 @@ type response struct {
 const DEFAULT_DELAY = 0 * time.Second
 const DEFAULT_CAPACITY = 5
 
+// DEFAULT_CONCURRENCY is the default number of queries in flight at once, see SetConcurrency
+const DEFAULT_CONCURRENCY = 4
+
 func init() {
 	// Configure a timeout to HTTP client (DefaultClient has no default timeout,
 	// which may deadlock Mutex-wrapped uses of the lib.)
@@ -111,49 +172,35 @@ func init() {
 
 //NewTwitterApi takes an user-specific access token and secret and returns a TwitterApi struct for that user.
 //The TwitterApi struct can be used for accessing any of the endpoints available.
+//The consumer key and secret are those set by SetConsumerKey and SetConsumerSecret, see NewTwitterApiWithOptions
+//to give them explicitly.
 func NewTwitterApi(access_token string, access_token_secret string) *TwitterApi {
-	//TODO figure out how much to buffer this channel
-	//A non-buffered channel will cause blocking when multiple queries are made at the same time
-	queue := make(chan query)
-	c := &TwitterApi{
-		oauthClient: oauth.Client{
-			TemporaryCredentialRequestURI: "https://api.twitter.com/oauth/request_token",
-			ResourceOwnerAuthorizationURI: "https://api.twitter.com/oauth/authenticate",
-			TokenRequestURI:               "https://api.twitter.com/oauth/access_token",
-			Credentials:                   oauthCredentials,
-		},
-		Credentials: &oauth.Credentials{
-			Token:  access_token,
-			Secret: access_token_secret,
-		},
-		queryQueue:           queue,
-		bucket:               nil,
-		returnRateLimitError: false,
-		HttpClient:           defaultClient,
-		Log:                  silentLogger{},
-		baseUrl:              BaseUrl,
-	}
-	go c.throttledQuery()
-	return c
+	return NewTwitterApiWithOptions(
+		WithConsumerCredentials(oauthCredentials.Token, oauthCredentials.Secret),
+		WithAccessCredentials(access_token, access_token_secret),
+	)
 }
 
 //NewTwitterApiWithCredentials takes an app-specific consumer key and secret, along with a user-specific access token and secret and returns a TwitterApi struct for that user.
 //The TwitterApi struct can be used for accessing any of the endpoints available.
 func NewTwitterApiWithCredentials(access_token string, access_token_secret string, consumer_key string, consumer_secret string) *TwitterApi {
-	api := NewTwitterApi(access_token, access_token_secret)
-	api.oauthClient.Credentials.Token = consumer_key
-	api.oauthClient.Credentials.Secret = consumer_secret
-	return api
+	return NewTwitterApiWithOptions(
+		WithConsumerCredentials(consumer_key, consumer_secret),
+		WithAccessCredentials(access_token, access_token_secret),
+	)
 }
 
 //SetConsumerKey will set the application-specific consumer_key used in the initial OAuth process
 //This key is listed on https://dev.twitter.com/apps/YOUR_APP_ID/show
+//It applies to the clients created afterwards by NewTwitterApi, and is not safe for concurrent use:
+//prefer NewTwitterApiWithOptions and WithConsumerCredentials.
 func SetConsumerKey(consumer_key string) {
 	oauthCredentials.Token = consumer_key
 }
 
 //SetConsumerSecret will set the application-specific secret used in the initial OAuth process
 //This secret is listed on https://dev.twitter.com/apps/YOUR_APP_ID/show
+//Like SetConsumerKey, prefer NewTwitterApiWithOptions and WithConsumerCredentials.
 func SetConsumerSecret(consumer_secret string) {
 	oauthCredentials.Secret = consumer_secret
 }
@@ -190,22 +237,73 @@ func (c *TwitterApi) SetBaseUrl(baseUrl string) {
 	c.baseUrl = baseUrl
 }
 
-//AuthorizationURL generates the authorization URL for the first part of the OAuth handshake.
-//Redirect the user to this URL.
-//This assumes that the consumer key has already been set (using SetConsumerKey or NewTwitterApiWithCredentials).
-func (c *TwitterApi) AuthorizationURL(callback string) (string, *oauth.Credentials, error) {
-	tempCred, err := c.oauthClient.RequestTemporaryCredentials(http.DefaultClient, callback, nil)
-	if err != nil {
-		return "", nil, err
+// SetStreamBaseUrl is experimental and may be removed in future releases.
+// It replaces the base URL of every streaming endpoint.
+func (c *TwitterApi) SetStreamBaseUrl(baseUrl string) {
+	c.streamBaseUrl = baseUrl
+}
+
+// SetStreamBackoffs replaces the back off strategies applied by the streams before they reconnect:
+// tcpip after a network error, http after an HTTP error such as 503 and http420 after
+// being rate limited. A nil function keeps the default strategy, respectively
+// NewTCPIPErrBackoff, NewHTTPErrBackoff and NewHTTP420ErrBackoff.
+func (c *TwitterApi) SetStreamBackoffs(tcpip, http, http420 func() backoff.Interface) {
+	c.streamBackoffs = streamBackoffs{tcpip, http, http420}
+}
+
+// SetStreamIdleTimeout sets how long a stream waits for data before it considers the connection stalled,
+// drops it and reconnects. Twitter sends a blank line every 30 seconds to keep idle streams alive.
+// Defaults to StreamIdleTimeout.
+func (c *TwitterApi) SetStreamIdleTimeout(d time.Duration) {
+	c.streamIdleTimeout = d
+}
+
+// SetStreamMaxMessageSize sets the size in bytes over which the messages of a stream are dropped
+// and reported as a StreamErrorEvent. Defaults to StreamMaxMessageSize.
+func (c *TwitterApi) SetStreamMaxMessageSize(n int) {
+	c.streamMaxMessageSize = n
+}
+
+// SetMaxErrorBodySize sets how many bytes of the body of an error response are read into the ApiError,
+// so that a misbehaving proxy cannot exhaust the memory. Defaults to DefaultMaxErrorBodySize.
+func (c *TwitterApi) SetMaxErrorBodySize(n int64) {
+	c.maxErrorBodySize = n
+}
+
+func (c TwitterApi) errorBodySize() int64 {
+	if c.maxErrorBodySize > 0 {
+		return c.maxErrorBodySize
 	}
-	return c.oauthClient.AuthorizationURL(tempCred, nil), tempCred, nil
+	return DefaultMaxErrorBodySize
 }
 
-// GetCredentials gets the access token using the verifier received with the callback URL and the
-// credentials in the first part of the handshake. GetCredentials implements the third part of the OAuth handshake.
-// The returned url.Values holds the access_token, the access_token_secret, the user_id and the screen_name.
-func (c *TwitterApi) GetCredentials(tempCred *oauth.Credentials, verifier string) (*oauth.Credentials, url.Values, error) {
-	return c.oauthClient.RequestToken(http.DefaultClient, tempCred, verifier)
+// WithContext returns a shallow copy of the client whose endpoint methods are bound to ctx.
+// The copy shares the query queue, throttling and credentials of the original client.
+//
+// A query issued through the copy gives up and returns ctx.Err() as soon as ctx is done,
+// whether it is still waiting in the queue, waiting for a throttling token,
+// waiting for a rate limit window to reset or in the middle of the HTTP round trip.
+// A cancelled query is never retried.
+//
+//  ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+//  defer cancel()
+//  result, err := api.WithContext(ctx).GetSearch("golang", nil)
+func (c *TwitterApi) WithContext(ctx context.Context) *TwitterApi {
+	if ctx == nil {
+		panic("anaconda: nil context")
+	}
+	c2 := *c
+	c2.ctx = ctx
+	return &c2
+}
+
+// Context returns the context bound to the client by WithContext.
+// The returned context is always non-nil; it defaults to the background context.
+func (c TwitterApi) Context() context.Context {
+	if c.ctx != nil {
+		return c.ctx
+	}
+	return context.Background()
 }
 
 func defaultValues(v url.Values) url.Values {
@@ -223,157 +321,440 @@ func cleanValues(v url.Values) url.Values {
 	return v
 }
 
+// newRequest builds an OAuth signed request bound to ctx.
+// It mirrors oauth.Client.Get/Post/Delete/Put, which have no way of carrying a context:
+// for GET and DELETE the form is sent as the query string, otherwise as an url-encoded body.
+// Unlike oauth.Client.Delete, which sends it as a body, DELETE sends the form as the query string for every
+// endpoint: the DELETE endpoints of Twitter read their parameters from the query string, and servers and
+// proxies may drop the body of a DELETE. The form is part of the OAuth signature either way.
+func (c TwitterApi) newRequest(ctx context.Context, method string, urlStr string, form url.Values) (*http.Request, error) {
+	inQuery := method == http.MethodGet || method == http.MethodDelete
+	var body io.Reader
+	if !inQuery {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, urlStr, body)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.signRequest(req, form); err != nil {
+		return nil, err
+	}
+	if inQuery {
+		req.URL.RawQuery = form.Encode()
+	} else {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	return req, nil
+}
+
+// newJSONRequest builds an OAuth signed request bound to ctx, sending body as a JSON payload.
+// JSON payloads are not part of the OAuth signature.
+func (c TwitterApi) newJSONRequest(ctx context.Context, method string, urlStr string, body []byte) (*http.Request, error) {
+	return c.newPayloadRequest(ctx, method, urlStr, "application/json", body)
+}
+
+// newPayloadRequest builds an OAuth signed request bound to ctx, sending body with contentType.
+// Like JSON payloads, multipart payloads are not part of the OAuth signature.
+func (c TwitterApi) newPayloadRequest(ctx context.Context, method string, urlStr string, contentType string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, urlStr, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if err := c.signRequest(req, nil); err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return req, nil
+}
+
+// signRequest adds the headers of the OAuth client and the OAuth signature of form to req,
+// or the bearer token of an application-only client.
+func (c TwitterApi) signRequest(req *http.Request, form url.Values) error {
+	if req.URL.RawQuery != "" {
+		return errors.New("oauth: url must not contain a query string")
+	}
+	if c.bearer != nil {
+		token, err := c.bearerToken(req.Context())
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+	for k, v := range c.oauthClient.Header {
+		req.Header[k] = v
+	}
+	return c.oauthClient.SetAuthorizationHeader(req.Header, c.Credentials, req.Method, req.URL, form)
+}
+
+// do signs and sends a request to the Twitter API with the client's HttpClient.
+func (c TwitterApi) do(ctx context.Context, method string, urlStr string, form url.Values) (*http.Response, error) {
+	req, err := c.newRequest(ctx, method, urlStr, form)
+	if err != nil {
+		return nil, err
+	}
+	return c.roundTrip(req, form)
+}
+
+// roundTrip sends req, signed with form, through the middlewares to send, see Use.
+// The error of a failed status is its *ApiError.
+func (c TwitterApi) roundTrip(req *http.Request, form url.Values) (*http.Response, error) {
+	next := c.send
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		next = c.middlewares[i](next)
+	}
+	resp, err := next(&Request{Request: req, Endpoint: rateLimitResource(req.URL), Form: form})
+	if resp != nil && resp.Request == nil {
+		// a response made up by a middleware, such as a cache
+		resp.Request = req
+	}
+	return resp, err
+}
+
+// send sends r with the client's HttpClient, records the rate limit headers of the response
+// and reads the *ApiError of a failed status
+func (c TwitterApi) send(r *Request) (*http.Response, error) {
+	resp, err := c.httpClient().Do(r.Request)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && c.bearer != nil {
+		c.forgetBearerToken(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	}
+	c.rateLimits.record(r.Endpoint, resp.Header)
+	if c.rateLimiter != nil {
+		c.rateLimiter.Update(r.Endpoint, resp.Header)
+	}
+	if err := c.checkStatus(resp); err != nil {
+		resp.Body.Close()
+		return resp, err
+	}
+	return resp, nil
+}
+
+func (c TwitterApi) httpClient() *http.Client {
+	if c.HttpClient == nil {
+		return http.DefaultClient
+	}
+	return c.HttpClient
+}
+
 // apiGet issues a GET request to the Twitter API and decodes the response JSON to data.
-func (c TwitterApi) apiGet(urlStr string, form url.Values, data interface{}) error {
+func (c TwitterApi) apiGet(ctx context.Context, urlStr string, form url.Values, data interface{}) error {
 	//form = defaultValues(form)
 	//TODO(Mujibur): defaultValues(form) need to rethink, it fails for webhook
 	//its better to use from necessary caller place with adding url.Values{}
-	resp, err := c.oauthClient.Get(c.HttpClient, c.Credentials, urlStr, form)
+	resp, err := c.do(ctx, http.MethodGet, urlStr, form)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
-	return decodeResponse(resp, data)
+	return c.decodeResponse(resp, data)
 }
 
 // apiPost issues a POST request to the Twitter API and decodes the response JSON to data.
-func (c TwitterApi) apiPost(urlStr string, form url.Values, data interface{}) error {
-	resp, err := c.oauthClient.Post(c.HttpClient, c.Credentials, urlStr, form)
+func (c TwitterApi) apiPost(ctx context.Context, urlStr string, form url.Values, data interface{}) error {
+	resp, err := c.do(ctx, http.MethodPost, urlStr, form)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
-	return decodeResponse(resp, data)
+	return c.decodeResponse(resp, data)
 }
 
 // apiDel issues a DELETE request to the Twitter API and decodes the response JSON to data.
-func (c TwitterApi) apiDel(urlStr string, form url.Values, data interface{}) error {
-	resp, err := c.oauthClient.Delete(c.HttpClient, c.Credentials, urlStr, form)
+func (c TwitterApi) apiDel(ctx context.Context, urlStr string, form url.Values, data interface{}) error {
+	resp, err := c.do(ctx, http.MethodDelete, urlStr, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return c.decodeResponse(resp, data)
+}
+
+// apiPostJSON issues a POST request with a JSON payload to the Twitter API and decodes the response JSON to data.
+func (c TwitterApi) apiPostJSON(ctx context.Context, urlStr string, body []byte, data interface{}) error {
+	return c.apiPostPayload(ctx, urlStr, "application/json", body, data)
+}
+
+// apiPostPayload issues a POST request with a payload of contentType to the Twitter API and decodes the response JSON to data.
+func (c TwitterApi) apiPostPayload(ctx context.Context, urlStr string, contentType string, body []byte, data interface{}) error {
+	req, err := c.newPayloadRequest(ctx, http.MethodPost, urlStr, contentType, body)
+	if err != nil {
+		return err
+	}
+	resp, err := c.roundTrip(req, nil)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
-	return decodeResponse(resp, data)
+	return c.decodeResponse(resp, data)
 }
 
 // apiPut issues a PUT request to the Twitter API and decodes the response JSON to data.
-func (c TwitterApi) apiPut(urlStr string, form url.Values, data interface{}) error {
-	resp, err := c.oauthClient.Put(c.HttpClient, c.Credentials, urlStr, form)
+func (c TwitterApi) apiPut(ctx context.Context, urlStr string, form url.Values, data interface{}) error {
+	resp, err := c.do(ctx, http.MethodPut, urlStr, form)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
-	return decodeResponse(resp, data)
+	return c.decodeResponse(resp, data)
 }
 
 // decodeResponse decodes the JSON response from the Twitter API.
-func decodeResponse(resp *http.Response, data interface{}) error {
+func (c TwitterApi) decodeResponse(resp *http.Response, data interface{}) error {
 	// Prevent memory leak in the case where the Response.Body is not used.
 	// As per the net/http package, Response.Body still needs to be closed.
 	defer resp.Body.Close()
 
-	// Twitter returns deflate data despite the client only requesting gzip
-	// data.  net/http automatically handles the latter but not the former:
-	// https://github.com/golang/go/issues/18779
-	if resp.Header.Get("Content-Encoding") == "deflate" {
-		var err error
-		resp.Body, err = zlib.NewReader(resp.Body)
-		if err != nil {
-			return err
-		}
+	if resp.StatusCode == 204 {
+		// empty response, don't decode
+		// 204 No Content is a success for every endpoint, such as the DELETE endpoints, not only the webhooks
+		return nil
 	}
+	if err := c.checkStatus(resp); err != nil {
+		return err
+	}
+	// the caller is not interested in the response body
+	if data == nil {
+		return nil
+	}
+	body, err := responseBody(resp)
+	if err != nil {
+		return err
+	}
+	return json.NewDecoder(body).Decode(data)
+}
 
+// checkStatus returns the *ApiError of resp when its status is a failure
+func (c TwitterApi) checkStatus(resp *http.Response) error {
+	if resp.StatusCode == 204 {
+		return nil
+	}
 	// according to dev.twitter.com, chunked upload append returns HTTP 2XX
 	// so we need a special case when decoding the response
 	if strings.HasSuffix(resp.Request.URL.String(), "upload.json") ||
+		strings.HasSuffix(resp.Request.URL.Path, "update_profile_banner.json") ||
 		strings.Contains(resp.Request.URL.String(), "webhooks") ||
 		strings.Contains(resp.Request.URL.String(), "subscriptions") {
-		if resp.StatusCode == 204 {
-			// empty response, don't decode
-			return nil
-		}
 		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			return newApiError(resp)
+			return newApiError(resp, c.errorBodySize())
 		}
 	} else if resp.StatusCode != 200 {
-		return newApiError(resp)
+		return newApiError(resp, c.errorBodySize())
 	}
-	return json.NewDecoder(resp.Body).Decode(data)
+	return nil
 }
 
-func NewApiError(resp *http.Response) *ApiError {
-	body, _ := ioutil.ReadAll(resp.Body)
-
-	return &ApiError{
-		StatusCode: resp.StatusCode,
-		Header:     resp.Header,
-		Body:       string(body),
-		URL:        resp.Request.URL,
+// responseBody returns the body of resp, decompressed according to its Content-Encoding.
+// Twitter returns deflate data despite the client only requesting gzip
+// data.  net/http automatically handles the latter but not the former:
+// https://github.com/golang/go/issues/18779
+// Neither does it handle gzip when the Accept-Encoding was set by the caller or a proxy.
+func responseBody(resp *http.Response) (io.Reader, error) {
+	switch resp.Header.Get("Content-Encoding") {
+	case "deflate":
+		return zlib.NewReader(resp.Body)
+	case "gzip":
+		return gzip.NewReader(resp.Body)
 	}
+	return resp.Body, nil
 }
 
 //query executes a query to the specified url, sending the values specified by form, and decodes the response JSON to data
 //method can be either _GET or _POST
-func (c TwitterApi) execQuery(urlStr string, form url.Values, data interface{}, method int) error {
+func (c TwitterApi) execQuery(ctx context.Context, urlStr string, form url.Values, body []byte, contentType string, data interface{}, method int) error {
 	switch method {
 	case _GET:
-		return c.apiGet(urlStr, form, data)
+		return c.apiGet(ctx, urlStr, form, data)
 	case _POST:
-		return c.apiPost(urlStr, form, data)
+		return c.apiPost(ctx, urlStr, form, data)
 	case _DELETE:
-		return c.apiDel(urlStr, form, data)
+		return c.apiDel(ctx, urlStr, form, data)
 	case _PUT:
-		return c.apiPut(urlStr, form, data)
+		return c.apiPut(ctx, urlStr, form, data)
+	case _POST_JSON:
+		return c.apiPostJSON(ctx, urlStr, body, data)
+	case _POST_MULTIPART:
+		return c.apiPostPayload(ctx, urlStr, contentType, body, data)
 	default:
 		return fmt.Errorf("HTTP method not yet supported")
 	}
 }
 
-// throttledQuery executes queries and automatically throttles them according to SECONDS_PER_QUERY
-// It is the only function that reads from the queryQueue for a particular *TwitterApi struct
+// sendQuery hands a query over to throttledQuery, which queues it for the worker of its endpoint family,
+// and waits for its response.
+// The query is bound to the client's context: sendQuery returns ctx.Err() as soon as the context is done,
+// whether the query is still queued or waiting behind the other queries of its family.
+// The worker drops the queries whose context is done instead of executing them.
+func (c TwitterApi) sendQuery(urlStr string, form url.Values, data interface{}, method int) error {
+	return c.enqueue(query{url: urlStr, form: form, data: data, method: method})
+}
+
+// sendJSONQuery is sendQuery for the endpoints which take a JSON payload instead of a form.
+func (c TwitterApi) sendJSONQuery(urlStr string, payload interface{}, data interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return c.enqueue(query{url: urlStr, body: body, data: data, method: _POST_JSON})
+}
 
+// sendMultipartQuery is sendQuery for the endpoints which take files, sent with the fields as a multipart/form-data payload.
+// files maps the names of the fields to their content.
+func (c TwitterApi) sendMultipartQuery(urlStr string, fields url.Values, files map[string][]byte, data interface{}) error {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for name, values := range fields {
+		for _, value := range values {
+			if err := w.WriteField(name, value); err != nil {
+				return err
+			}
+		}
+	}
+	for name, content := range files {
+		part, err := w.CreateFormFile(name, name)
+		if err != nil {
+			return err
+		}
+		if _, err := part.Write(content); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.enqueue(query{url: urlStr, body: body.Bytes(), contentType: w.FormDataContentType(), data: data, method: _POST_MULTIPART})
+}
+
+func (c TwitterApi) enqueue(q query) error {
+	ctx := c.Context()
+	q.ctx = ctx
+	// buffered, so that the worker never blocks on a query which was given up
+	q.response_ch = make(chan response, 1)
+	select {
+	case c.queryQueue <- q:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case r := <-q.response_ch:
+		return r.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttledQuery dispatches the queries to a worker per endpoint family, which executes them in order and
+// automatically throttles them according to the bucket, the rate limiter and the rate limit errors of Twitter.
+// At most the concurrency of the pool are in flight at once, see SetConcurrency.
+// It is the only function that reads from the queryQueue for a particular *TwitterApi struct
 func (c *TwitterApi) throttledQuery() {
 	for q := range c.queryQueue {
-		url := q.url
-		form := q.form
-		data := q.data //This is where the actual response will be written
-		method := q.method
+		q.resource = queryResource(q.url)
+		if c.pool.push(q) {
+			go c.familyQueries(q.resource)
+		}
+	}
+}
 
-		response_ch := q.response_ch
+// familyQueries executes the queries of an endpoint family until there are no more
+func (c *TwitterApi) familyQueries(resource string) {
+	for {
+		q, ok := c.pool.next(resource)
+		if !ok {
+			return
+		}
+		// The query may have been cancelled while it was waiting behind the others of its family
+		if err := q.ctx.Err(); err != nil {
+			q.response_ch <- response{q.data, err}
+			continue
+		}
+		q.response_ch <- response{q.data, c.runQuery(q)}
+	}
+}
 
-		if c.bucket != nil {
-			<-c.bucket.SpendToken(1)
+// runQuery executes q, retrying it as long as the retry policy allows, see SetRetryPolicy.
+// The retries of a query go ahead of the other queries of its family.
+func (c *TwitterApi) runQuery(q query) error {
+	var waited time.Duration
+	for attempt := 1; ; attempt++ {
+		// The query may have been cancelled while it was waiting in the queue
+		if err := q.ctx.Err(); err != nil {
+			return err
 		}
 
-		err := c.execQuery(url, form, data, method)
+		if c.rateLimiter != nil {
+			if err := c.rateLimiter.Wait(q.ctx, q.resource); err != nil {
+				return err
+			}
+		}
 
-		// Check if Twitter returned a rate-limiting error
+		if c.bucket != nil {
+			token := c.bucket.SpendToken(1)
+			select {
+			case <-token:
+			case <-q.ctx.Done():
+				// Let the token be taken anyway so the bucket goroutine isn't leaked
+				go func() { <-token }()
+				return q.ctx.Err()
+			}
+		}
+
+		release, err := c.pool.acquire(q.ctx)
 		if err != nil {
-			if apiErr, ok := err.(*ApiError); ok {
-				if isRateLimitError, nextWindow := apiErr.RateLimitCheck(); isRateLimitError && !c.returnRateLimitError {
-					c.Log.Info(apiErr.Error())
-
-					// If this is a rate-limiting error, re-add the job to the queue
-					// TODO it really should preserve order
-					go func(q query) {
-						c.queryQueue <- q
-					}(q)
-
-					delay := nextWindow.Sub(time.Now())
-					<-time.After(delay)
-
-					// Drain the bucket (start over fresh)
-					if c.bucket != nil {
-						c.bucket.Drain()
-					}
-
-					continue
-				}
+			return err
+		}
+		err = c.execQuery(q.ctx, q.url, q.form, q.body, q.contentType, q.data, q.method)
+		release()
+		if err == nil {
+			return nil
+		}
+
+		// A cancelled round trip reports the context error, not the transport error
+		if q.ctx.Err() != nil {
+			return q.ctx.Err()
+		}
+
+		wait, retry := c.retryWait(q, attempt, waited, err)
+		if !retry {
+			return err
+		}
+		c.Log.Infof("Retrying in %s after: %s", wait, err)
+		waited += wait
+
+		isRateLimitError := classifyRetry(err) == retryRateLimit
+		if isRateLimitError && c.rateLimiter != nil {
+			// the rate limiter holds the family back until the next window
+			header := http.Header{}
+			header.Set("X-Rate-Limit-Remaining", "0")
+			header.Set("X-Rate-Limit-Reset", strconv.FormatInt(time.Now().Add(wait).Unix(), 10))
+			c.rateLimiter.Update(q.resource, header)
+		} else {
+			t := time.NewTimer(wait)
+			select {
+			case <-t.C:
+			case <-q.ctx.Done():
+				t.Stop()
+				return q.ctx.Err()
 			}
 		}
 
-		response_ch <- response{data, err}
+		// Drain the bucket (start over fresh)
+		if isRateLimitError && c.bucket != nil {
+			c.bucket.Drain()
+		}
+	}
+}
+
+// queryResource returns the rate limit resource of the URL of a query
+func queryResource(urlStr string) string {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return urlStr
 	}
+	return rateLimitResource(u)
 }
 
 // Close query queue
@@ -1,6 +1,7 @@
 package anaconda_test
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -105,6 +106,17 @@ func init() {
 	}
 }
 
+// newTestApi returns a client whose queries are answered by handler
+func newTestApi(t *testing.T, handler http.HandlerFunc) *anaconda.TwitterApi {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	apiLocal := anaconda.NewTwitterApiWithCredentials("", "", "", "")
+	apiLocal.SetBaseUrl(server.URL)
+	t.Cleanup(apiLocal.Close)
+	return apiLocal
+}
+
 // Test_TwitterCredentials tests that non-empty Twitter credentials are set
 // Without this, all following tests will fail
 func Test_TwitterCredentials(t *testing.T) {
@@ -435,3 +447,37 @@ func Test_TwitterApi_Throttling(t *testing.T) {
 	// Reset the delay to its previous value
 	api.SetDelay(oldDelay)
 }
+
+// Test that a query bound to a cancelled context returns the context error
+// and that a deadline interrupts a request that is stuck in the HTTP round trip
+func Test_TwitterApi_WithContext(t *testing.T) {
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-unblock:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(unblock)
+
+	apiLocal := anaconda.NewTwitterApiWithCredentials("", "", "", "")
+	apiLocal.SetBaseUrl(server.URL)
+	defer apiLocal.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := apiLocal.WithContext(ctx).GetSearch("golang", nil); err != context.Canceled {
+		t.Fatalf("Expected %v from a cancelled context, received %v", context.Canceled, err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := apiLocal.WithContext(ctx).GetSearch("golang", nil); err != context.DeadlineExceeded {
+		t.Fatalf("Expected %v from an expired context, received %v", context.DeadlineExceeded, err)
+	}
+
+	if apiLocal.Context() != context.Background() {
+		t.Fatalf("WithContext should not change the context of the original client")
+	}
+}
@@ -8,9 +8,8 @@ import (
 func (a TwitterApi) GetUsersLookup(usernames string, v url.Values) (u []User, err error) {
 	v = cleanValues(v)
 	v.Set("screen_name", usernames)
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/users/lookup.json", v, &u, _GET, response_ch}
-	return u, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/users/lookup.json", v, &u, _GET)
+	return u, err
 }
 
 func (a TwitterApi) GetUsersLookupByIds(ids []int64, v url.Values) (u []User, err error) {
@@ -24,25 +23,22 @@ func (a TwitterApi) GetUsersLookupByIds(ids []int64, v url.Values) (u []User, er
 	}
 	v = cleanValues(v)
 	v.Set("user_id", pids)
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/users/lookup.json", v, &u, _GET, response_ch}
-	return u, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/users/lookup.json", v, &u, _GET)
+	return u, err
 }
 
 func (a TwitterApi) GetUsersShow(username string, v url.Values) (u User, err error) {
 	v = cleanValues(v)
 	v.Set("screen_name", username)
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/users/show.json", v, &u, _GET, response_ch}
-	return u, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/users/show.json", v, &u, _GET)
+	return u, err
 }
 
 func (a TwitterApi) GetUsersShowById(id int64, v url.Values) (u User, err error) {
 	v = cleanValues(v)
 	v.Set("user_id", strconv.FormatInt(id, 10))
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/users/show.json", v, &u, _GET, response_ch}
-	return u, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/users/show.json", v, &u, _GET)
+	return u, err
 }
 
 func (a TwitterApi) GetUserSearch(searchTerm string, v url.Values) (u []User, err error) {
@@ -50,24 +46,21 @@ func (a TwitterApi) GetUserSearch(searchTerm string, v url.Values) (u []User, er
 	v.Set("q", searchTerm)
 	// Set other values before calling this method:
 	// page, count, include_entities
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/users/search.json", v, &u, _GET, response_ch}
-	return u, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/users/search.json", v, &u, _GET)
+	return u, err
 }
 
 func (a TwitterApi) GetUsersSuggestions(v url.Values) (c []Category, err error) {
 	v = cleanValues(v)
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/users/suggestions.json", v, &c, _GET, response_ch}
-	return c, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/users/suggestions.json", v, &c, _GET)
+	return c, err
 }
 
 func (a TwitterApi) GetUsersSuggestionsBySlug(slug string, v url.Values) (s Suggestions, err error) {
 	v = cleanValues(v)
 	v.Set("slug", slug)
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/users/suggestions/" + slug + ".json", v, &s, _GET, response_ch}
-	return s, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/users/suggestions/" + slug + ".json", v, &s, _GET)
+	return s, err
 }
 
 // PostUsersReportSpam : Reports and Blocks a User by screen_name
@@ -77,9 +70,8 @@ func (a TwitterApi) GetUsersSuggestionsBySlug(slug string, v url.Values) (s Sugg
 func (a TwitterApi) PostUsersReportSpam(username string, v url.Values) (u User, err error) {
 	v = cleanValues(v)
 	v.Set("screen_name", username)
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/users/report_spam.json", v, &u, _POST, response_ch}
-	return u, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/users/report_spam.json", v, &u, _POST)
+	return u, err
 }
 
 // PostUsersReportSpamById : Reports and Blocks a User by user_id
@@ -89,7 +81,6 @@ func (a TwitterApi) PostUsersReportSpam(username string, v url.Values) (u User,
 func (a TwitterApi) PostUsersReportSpamById(id int64, v url.Values) (u User, err error) {
 	v = cleanValues(v)
 	v.Set("user_id", strconv.FormatInt(id, 10))
-	response_ch := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/users/report_spam.json", v, &u, _POST, response_ch}
-	return u, (<-response_ch).err
+	err = a.sendQuery(a.baseUrl+"/users/report_spam.json", v, &u, _POST)
+	return u, err
 }
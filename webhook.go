@@ -1,56 +1,196 @@
 package anaconda
 
 import (
+	"errors"
 	"net/url"
 )
 
+// Account Activity API tiers accepted by the apiTier parameter of the webhook functions.
+// The premium tier addresses webhooks by environment name (envName),
+// the enterprise tier by webhook id (webhookID).
+const (
+	EnterpriseAPITier = "enterprise"
+	PremiumAPITier    = "premium"
+)
+
 var (
-	enterpriseAPITier = "enterprise"
-	premiumAPITier    = "premium"
+	// ErrWHSubscriptionNotFound is returned by GetWHSubscription when the user is not subscribed to the webhook
+	// It matches ErrNotFound with errors.Is
+	ErrWHSubscriptionNotFound error = &sentinelError{"anaconda: webhook subscription not found", ErrNotFound}
+
+	// ErrInvalidAPITier is returned, before any request is sent, when apiTier is neither PremiumAPITier nor EnterpriseAPITier
+	ErrInvalidAPITier = errors.New("anaconda: invalid API tier, expected \"premium\" or \"enterprise\"")
+
+	// ErrMissingEnvName is returned when a premium tier operation is called without an environment name
+	ErrMissingEnvName = errors.New("anaconda: premium API tier requires an environment name")
+
+	// ErrMissingWebhookID is returned when an operation on a single webhook is called without its id
+	ErrMissingWebhookID = errors.New("anaconda: a webhook id is required")
+)
+
+// Account Activity API operations, see webhookURL
+const (
+	whWebhooks = iota
+	// whWebhooks, or the webhooks of every environment without an environment
+	whAllWebhooks
+	whWebhook
+	whSubscriptions
+	whSubscriptionsList
+	whSubscriptionsCount
 )
 
+// webhookURL builds the URL of an Account Activity API operation for the given tier.
+//
+//  premium                                            enterprise
+//  /account_activity/all/:env/webhooks.json           /account_activity/webhooks.json
+//  /account_activity/all/:env/webhooks/:id.json       /account_activity/webhooks/:id.json
+//  /account_activity/all/:env/subscriptions.json      /account_activity/webhooks/:id/subscriptions/all.json
+//  /account_activity/all/:env/subscriptions/list.json /account_activity/webhooks/:id/subscriptions/all/list.json
+//  /account_activity/all/subscriptions/count.json     /account_activity/subscriptions/count.json
+//
+// The premium whAllWebhooks URL without an environment lists the webhooks of every environment.
+func webhookURL(baseURL string, operation int, apiTier, envName, webhookID string) (string, error) {
+	switch apiTier {
+	case PremiumAPITier:
+		if operation == whSubscriptionsCount {
+			return baseURL + "/account_activity/all/subscriptions/count.json", nil
+		}
+		if operation == whAllWebhooks && envName == "" {
+			return baseURL + "/account_activity/all/webhooks.json", nil
+		}
+		if envName == "" {
+			return "", ErrMissingEnvName
+		}
+		envURL := baseURL + "/account_activity/all/" + url.PathEscape(envName)
+		switch operation {
+		case whWebhooks, whAllWebhooks:
+			return envURL + "/webhooks.json", nil
+		case whWebhook:
+			if webhookID == "" {
+				return "", ErrMissingWebhookID
+			}
+			return envURL + "/webhooks/" + url.PathEscape(webhookID) + ".json", nil
+		case whSubscriptions:
+			return envURL + "/subscriptions.json", nil
+		case whSubscriptionsList:
+			return envURL + "/subscriptions/list.json", nil
+		}
+	case EnterpriseAPITier:
+		switch operation {
+		case whWebhooks, whAllWebhooks:
+			return baseURL + "/account_activity/webhooks.json", nil
+		case whSubscriptionsCount:
+			return baseURL + "/account_activity/subscriptions/count.json", nil
+		}
+		if webhookID == "" {
+			return "", ErrMissingWebhookID
+		}
+		idURL := baseURL + "/account_activity/webhooks/" + url.PathEscape(webhookID)
+		switch operation {
+		case whWebhook:
+			return idURL + ".json", nil
+		case whSubscriptions:
+			return idURL + "/subscriptions/all.json", nil
+		case whSubscriptionsList:
+			return idURL + "/subscriptions/all/list.json", nil
+		}
+	default:
+		return "", ErrInvalidAPITier
+	}
+	return "", errors.New("anaconda: unknown account activity operation")
+}
+
 //GetAppActivityWebhooks represents the twitter account_activity webhook
 //Returns all URLs and their statuses for the given app. Currently,
 //only one webhook URL can be registered to an application.
+//With the premium tier and an empty envName, the webhooks of every environment of the app are returned,
+//EnvironmentName tells them apart. webhookID is not used.
 //https://dev.twitter.com/webhooks/reference/get/account_activity/webhooks
-func (a TwitterApi) GetAppActivityWebhooks(v url.Values, envName, webhookID, apiTier string) (u interface{}, err error) {
+func (a TwitterApi) GetAppActivityWebhooks(v url.Values, envName, webhookID, apiTier string) (webhooks []WebHookResp, err error) {
 	v = cleanValues(v)
-	responseCh := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/account_activity/all/webhooks.json", v, &u, _GET, responseCh}
-	return u, (<-responseCh).err
-}
+	URL, err := webhookURL(a.baseUrl, whAllWebhooks, apiTier, envName, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	if apiTier == EnterpriseAPITier || envName != "" {
+		err = a.sendQuery(URL, v, &webhooks, _GET)
+		for i := range webhooks {
+			webhooks[i].EnvironmentName = envName
+		}
+		return webhooks, err
+	}
 
-func getWebhookURL(baseURL, apiTier, envName, webhookID string) string {
-	if apiTier == premiumAPITier {
-		//https://api.twitter.com/1.1/account_activity/all/webhooks.json
-		return baseURL + "/account_activity/all/" + envName + "/subscriptions.json"
+	var envs WebHookEnvironments
+	err = a.sendQuery(URL, v, &envs, _GET)
+	for _, env := range envs.Environments {
+		for _, w := range env.Webhooks {
+			w.EnvironmentName = env.EnvironmentName
+			webhooks = append(webhooks, w)
+		}
 	}
-	return baseURL + "/account_activity/webhooks/" + webhookID + "/subscriptions/all.json"
+	return webhooks, err
 }
 
 //CountAppActivityWebhooks Returns the count of subscriptions that are currently active on your account for all activities.
 //Note that the /count endpoint requires application-only OAuth, so that you should make requests using a bearer token
-//instead of user context.
-func (a TwitterApi) CountAppActivityWebhooks(v url.Values) (u interface{}, err error) {
+//instead of user context, see NewTwitterApiAppOnly.
+func (a TwitterApi) CountAppActivityWebhooks(v url.Values, apiTier string) (c WebHookCount, err error) {
 	v = cleanValues(v)
-	responseCh := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/account_activity/subscriptions/count.json", v, &u, _GET, responseCh}
-	return u, (<-responseCh).err
+	URL, err := webhookURL(a.baseUrl, whSubscriptionsCount, apiTier, "", "")
+	if err != nil {
+		return c, err
+	}
+	err = a.sendQuery(URL, v, &c, _GET)
+	return c, err
 }
 
-//WebHookCount represents the Get webhook responses
+//WebHookCount represents the count of subscriptions responses
+//The enterprise tier fills SubCountAll and SubsCountDM,
+//the premium tier fills SubsCount and ProvisionedCount.
 type WebHookCount struct {
-	AccountName string `json:"account_name"`
-	SubCountAll string `json:"subscriptions_count_all"`
-	SubsCountDM bool   `json:"subscriptions_count_direct_messages"`
+	AccountName      string `json:"account_name"`
+	SubCountAll      int    `json:"subscriptions_count_all,string"`
+	SubsCountDM      int    `json:"subscriptions_count_direct_messages,string"`
+	SubsCount        int    `json:"subscriptions_count,string"`
+	ProvisionedCount int    `json:"provisioned_count,string"`
 }
 
 //WebHookResp represents the Get webhook responses
 type WebHookResp struct {
-	ID        string `json:"id"`
-	URL       string `json:"url"`
-	Valid     bool   `json:"valid"`
-	CreatedAt string `json:"created_at"`
+	ID               string `json:"id"`
+	URL              string `json:"url"`
+	Valid            bool   `json:"valid"`
+	CreatedAt        string `json:"created_at"`
+	CreatedTimestamp string `json:"created_timestamp"`
+
+	// EnvironmentName is only set by GetAppActivityWebhooks for the premium tier
+	EnvironmentName string `json:"-"`
+}
+
+//WebHookEnvironments represents the webhooks of every environment of an app
+type WebHookEnvironments struct {
+	Environments []struct {
+		EnvironmentName string        `json:"environment_name"`
+		Webhooks        []WebHookResp `json:"webhooks"`
+	} `json:"environments"`
+}
+
+//WHSubscriptionList represents the users subscribed to a webhook
+type WHSubscriptionList struct {
+	Environment   string `json:"environment"`
+	ApplicationID string `json:"application_id"`
+	Subscriptions []struct {
+		UserID string `json:"user_id"`
+	} `json:"subscriptions"`
+}
+
+//UserIDs returns the ids of the subscribed users
+func (l WHSubscriptionList) UserIDs() []string {
+	ids := make([]string, 0, len(l.Subscriptions))
+	for _, s := range l.Subscriptions {
+		ids = append(ids, s.UserID)
+	}
+	return ids
 }
 
 //SetAppActivityWebhooks represents to set twitter account_activity webhook
@@ -59,82 +199,88 @@ type WebHookResp struct {
 //a comprehensive error is returned. message to the requester.
 //Only one webhook URL can be registered to an application.
 //https://api.twitter.com/1.1/account_activity/webhooks.json
-func (a TwitterApi) SetAppActivityWebhooks(v url.Values, envName, apiTier string) (u interface{}, err error) {
+func (a TwitterApi) SetAppActivityWebhooks(v url.Values, envName, apiTier string) (webhook WebHookResp, err error) {
 	v = cleanValues(v)
-	responseCh := make(chan response)
-	a.queryQueue <- query{a.baseUrl + "/account_activity/all/" + envName + "/webhooks.json", v, &u, _POST, responseCh}
-	return u, (<-responseCh).err
+	URL, err := webhookURL(a.baseUrl, whWebhooks, apiTier, envName, "")
+	if err != nil {
+		return webhook, err
+	}
+	err = a.sendQuery(URL, v, &webhook, _POST)
+	webhook.EnvironmentName = envName
+	return webhook, err
 }
 
 //DeleteAppActivityWebhooks Removes the webhook from the provided application’s configuration.
 //https://dev.twitter.com/webhooks/reference/del/account_activity/webhooks
-func (a TwitterApi) DeleteAppActivityWebhooks(v url.Values, envName, webhookID, apiTier string) (u interface{}, err error) {
+func (a TwitterApi) DeleteAppActivityWebhooks(v url.Values, envName, webhookID, apiTier string) (err error) {
 	v = cleanValues(v)
-	responseCh := make(chan response)
-	URL := a.baseUrl + "/account_activity/all/" + envName + "/webhooks/" + webhookID + ".json"
-	if apiTier == enterpriseAPITier {
-		URL = a.baseUrl + "/account_activity/webhooks/" + webhookID + ".json"
+	URL, err := webhookURL(a.baseUrl, whWebhook, apiTier, envName, webhookID)
+	if err != nil {
+		return err
 	}
-	a.queryQueue <- query{URL, v, &u, _DELETE, responseCh}
-	return u, (<-responseCh).err
+	return a.sendQuery(URL, v, nil, _DELETE)
 }
 
 //PutAppActivityWebhooks update webhook which reenables the webhook by setting its status to valid.
 //https://dev.twitter.com/webhooks/reference/put/account_activity/webhooks
-func (a TwitterApi) PutAppActivityWebhooks(v url.Values, envName, webhookID, apiTier string) (u interface{}, err error) {
+func (a TwitterApi) PutAppActivityWebhooks(v url.Values, envName, webhookID, apiTier string) (err error) {
 	v = cleanValues(v)
-	responseCh := make(chan response)
-	URL := a.baseUrl + "/account_activity/all/" + envName + "/webhooks/" + webhookID + ".json"
-	if apiTier == enterpriseAPITier {
-		URL = a.baseUrl + "/account_activity/webhooks/" + webhookID + ".json"
+	URL, err := webhookURL(a.baseUrl, whWebhook, apiTier, envName, webhookID)
+	if err != nil {
+		return err
 	}
-	a.queryQueue <- query{URL, v, &u, _PUT, responseCh}
-	return u, (<-responseCh).err
+	return a.sendQuery(URL, v, nil, _PUT)
 }
 
 //SetWHSubscription Subscribes the provided app to events for the provided user context.
 //When subscribed, all DM events for the provided user will be sent to the app’s webhook via POST request.
 //https://developer.twitter.com/en/docs/accounts-and-users/subscribe-account-activity/api-reference
-func (a TwitterApi) SetWHSubscription(v url.Values, envName, webhookID, apiTier string) (u interface{}, err error) {
+func (a TwitterApi) SetWHSubscription(v url.Values, envName, webhookID, apiTier string) (err error) {
 	v = cleanValues(v)
-	responseCh := make(chan response)
-	whURL := getWebhookURL(a.baseUrl, apiTier, envName, webhookID)
-	a.queryQueue <- query{whURL, v, &u, _POST, responseCh}
-	return u, (<-responseCh).err
+	URL, err := webhookURL(a.baseUrl, whSubscriptions, apiTier, envName, webhookID)
+	if err != nil {
+		return err
+	}
+	return a.sendQuery(URL, v, nil, _POST)
 }
 
 //GetWHSubscription Provides a way to determine if a webhook configuration is
 //subscribed to the provided user’s Direct Messages.
+//It returns nil if the user is subscribed and ErrWHSubscriptionNotFound if not.
 //https://dev.twitter.com/webhooks/reference/get/account_activity/webhooks/subscriptions
-func (a TwitterApi) GetWHSubscription(v url.Values, envName, webhookID, apiTier string) (u interface{}, err error) {
+func (a TwitterApi) GetWHSubscription(v url.Values, envName, webhookID, apiTier string) (err error) {
 	v = cleanValues(v)
-	responseCh := make(chan response)
-	//EnterPrise not impelmented
-	a.queryQueue <- query{a.baseUrl + "/account_activity/all/" + envName + "/subscriptions.json", v, &u, _GET, responseCh}
-	return u, (<-responseCh).err
+	URL, err := webhookURL(a.baseUrl, whSubscriptions, apiTier, envName, webhookID)
+	if err != nil {
+		return err
+	}
+	err = a.sendQuery(URL, v, nil, _GET)
+	if apiErr, ok := err.(*ApiError); ok && apiErr.StatusCode == 404 {
+		return ErrWHSubscriptionNotFound
+	}
+	return err
 }
 
-//GetWHSubscriptionList Provides a way to determine if a webhook configuration is
-//subscribed to the provided user’s Direct Messages.
-//https://dev.twitter.com/webhooks/reference/get/account_activity/webhooks/subscriptions
-func (a TwitterApi) GetWHSubscriptionList(v url.Values, envName, webhookID, apiTier string) (u interface{}, err error) {
+//GetWHSubscriptionList Returns a list of the current All Activity type subscriptions.
+//https://developer.twitter.com/en/docs/accounts-and-users/subscribe-account-activity/api-reference/aaa-premium
+func (a TwitterApi) GetWHSubscriptionList(v url.Values, envName, webhookID, apiTier string) (list WHSubscriptionList, err error) {
 	v = cleanValues(v)
-	responseCh := make(chan response)
-	//EnterPrise not impelmented
-	a.queryQueue <- query{a.baseUrl + "account_activity/all/" + envName + "/subscriptions/list.json", v, &u, _GET, responseCh}
-	return u, (<-responseCh).err
+	URL, err := webhookURL(a.baseUrl, whSubscriptionsList, apiTier, envName, webhookID)
+	if err != nil {
+		return list, err
+	}
+	err = a.sendQuery(URL, v, &list, _GET)
+	return list, err
 }
 
 //DeleteWHSubscription Deactivates subscription for the provided user context and app. After deactivation,
 //all DM events for the requesting user will no longer be sent to the webhook URL..
 //https://developer.twitter.com/en/docs/accounts-and-users/subscribe-account-activity/api-reference
-func (a TwitterApi) DeleteWHSubscription(v url.Values, envName, webhookID, apiTier string) (u interface{}, err error) {
+func (a TwitterApi) DeleteWHSubscription(v url.Values, envName, webhookID, apiTier string) (err error) {
 	v = cleanValues(v)
-	responseCh := make(chan response)
-	if apiTier == premiumAPITier {
-		a.queryQueue <- query{a.baseUrl + "/account_activity/all/" + envName + "/subscriptions.json", v, &u, _DELETE, responseCh}
-	} else {
-		a.queryQueue <- query{a.baseUrl + "/account_activity/webhooks/" + webhookID + "/subscriptions/all.json", v, &u, _DELETE, responseCh}
+	URL, err := webhookURL(a.baseUrl, whSubscriptions, apiTier, envName, webhookID)
+	if err != nil {
+		return err
 	}
-	return u, (<-responseCh).err
+	return a.sendQuery(URL, v, nil, _DELETE)
 }
@@ -0,0 +1,299 @@
+package anaconda
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// MaxWebhookBodySize is the largest Account Activity payload WebhookHandler accepts.
+const MaxWebhookBodySize = 10 << 20
+
+//AccountActivity is a single payload POSTed by the Account Activity API to a registered webhook.
+//Only the event lists relevant to the activity are set.
+//https://developer.twitter.com/en/docs/accounts-and-users/subscribe-account-activity/guides/account-activity-data-objects
+type AccountActivity struct {
+	ForUserID string `json:"for_user_id"`
+
+	TweetCreateEvents                 []Tweet                 `json:"tweet_create_events"`
+	TweetDeleteEvents                 []TweetDeleteEvent      `json:"tweet_delete_events"`
+	FavoriteEvents                    []FavoriteEvent         `json:"favorite_events"`
+	FollowEvents                      []UserActionEvent       `json:"follow_events"`
+	BlockEvents                       []UserActionEvent       `json:"block_events"`
+	MuteEvents                        []UserActionEvent       `json:"mute_events"`
+	UserEvent                         *UserRevokeEvent        `json:"user_event"`
+	DirectMessageEvents               []DMEvent               `json:"direct_message_events"`
+	DirectMessageIndicateTypingEvents []DMIndicateTypingEvent `json:"direct_message_indicate_typing_events"`
+	DirectMessageMarkReadEvents       []DMMarkReadEvent       `json:"direct_message_mark_read_events"`
+
+	// Users and Apps are keyed by id and describe the users and apps referenced in direct message events
+	Users map[string]DMUser `json:"users"`
+	Apps  map[string]DMApp  `json:"apps"`
+}
+
+//TweetDeleteEvent notifies the deletion of a Tweet, the tweet is identified by Status
+type TweetDeleteEvent struct {
+	Status struct {
+		ID     string `json:"id"`
+		UserID string `json:"user_id"`
+	} `json:"status"`
+	TimestampMs string `json:"timestamp_ms"`
+}
+
+//FavoriteEvent notifies that User liked FavoritedStatus
+type FavoriteEvent struct {
+	ID              string `json:"id"`
+	CreatedAt       string `json:"created_at"`
+	TimestampMs     int64  `json:"timestamp_ms"`
+	FavoritedStatus Tweet  `json:"favorited_status"`
+	User            User   `json:"user"`
+}
+
+//UserActionEvent is the payload of follow_events, block_events and mute_events.
+//Type holds the action: follow, unfollow, block, unblock, mute or unmute
+type UserActionEvent struct {
+	Type             string `json:"type"`
+	CreatedTimestamp string `json:"created_timestamp"`
+	Target           User   `json:"target"`
+	Source           User   `json:"source"`
+}
+
+//UserRevokeEvent notifies that a user revoked the authorization of the app
+type UserRevokeEvent struct {
+	Revoke struct {
+		DateTime string `json:"date_time"`
+		Target   struct {
+			AppID string `json:"app_id"`
+		} `json:"target"`
+		Source struct {
+			UserID string `json:"user_id"`
+		} `json:"source"`
+	} `json:"revoke"`
+}
+
+//DMIndicateTypingEvent notifies that SenderID is typing a direct message to the recipient
+type DMIndicateTypingEvent struct {
+	CreatedTimestamp string `json:"created_timestamp"`
+	SenderID         string `json:"sender_id"`
+	Target           struct {
+		RecipientID string `json:"recipient_id"`
+	} `json:"target"`
+}
+
+//DMMarkReadEvent notifies that SenderID read the conversation up to LastReadEventID
+type DMMarkReadEvent struct {
+	CreatedTimestamp string `json:"created_timestamp"`
+	SenderID         string `json:"sender_id"`
+	Target           struct {
+		RecipientID string `json:"recipient_id"`
+	} `json:"target"`
+	LastReadEventID string `json:"last_read_event_id"`
+}
+
+//DMUser is the compact user object attached to direct message events
+type DMUser struct {
+	ID                   string `json:"id"`
+	CreatedTimestamp     string `json:"created_timestamp"`
+	Name                 string `json:"name"`
+	ScreenName           string `json:"screen_name"`
+	Location             string `json:"location"`
+	Description          string `json:"description"`
+	URL                  string `json:"url"`
+	Protected            bool   `json:"protected"`
+	Verified             bool   `json:"verified"`
+	FollowersCount       int    `json:"followers_count"`
+	FriendsCount         int    `json:"friends_count"`
+	StatusesCount        int    `json:"statuses_count"`
+	ProfileImageURL      string `json:"profile_image_url"`
+	ProfileImageURLHttps string `json:"profile_image_url_https"`
+}
+
+//DMApp is the app a direct message was sent from
+type DMApp struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// WebhookHandler is an http.Handler receiving Account Activity API events
+// for a webhook registered with SetAppActivityWebhooks.
+//
+// GET requests answer the CRC challenge sent by Twitter when the webhook is registered
+// and hourly afterwards. POST requests must carry a valid x-twitter-webhooks-signature
+// header, they are decoded to an AccountActivity and each event is dispatched to
+// the matching callback. Callbacks are optional and run sequentially before
+// the handler answers, so long running work should be moved to another goroutine.
+//
+//  h := anaconda.NewWebhookHandler("your-consumer-secret")
+//  h.OnDirectMessage = func(a *anaconda.AccountActivity, e anaconda.DMEvent) {
+//      fmt.Println(a.Users[e.MessageCreate.SenderID].ScreenName, e.MessageCreate.MessageData.Text)
+//  }
+//  http.Handle("/webhooks/twitter", h)
+type WebhookHandler struct {
+	consumerSecret string
+
+	// Log receives the requests rejected by the handler
+	// Default logger is silent
+	Log Logger
+
+	OnTweetCreate                 func(a *AccountActivity, tweet Tweet)
+	OnTweetDelete                 func(a *AccountActivity, e TweetDeleteEvent)
+	OnFavorite                    func(a *AccountActivity, e FavoriteEvent)
+	OnFollow                      func(a *AccountActivity, e UserActionEvent)
+	OnBlock                       func(a *AccountActivity, e UserActionEvent)
+	OnMute                        func(a *AccountActivity, e UserActionEvent)
+	OnUserRevoke                  func(a *AccountActivity, e UserRevokeEvent)
+	OnDirectMessage               func(a *AccountActivity, e DMEvent)
+	OnDirectMessageIndicateTyping func(a *AccountActivity, e DMIndicateTypingEvent)
+	OnDirectMessageMarkRead       func(a *AccountActivity, e DMMarkReadEvent)
+
+	// OnActivity, if set, receives every decoded payload before the event callbacks
+	OnActivity func(a *AccountActivity)
+}
+
+// NewWebhookHandler returns a WebhookHandler which signs CRC responses
+// and verifies payload signatures with the app's consumer secret.
+func NewWebhookHandler(consumerSecret string) *WebhookHandler {
+	return &WebhookHandler{
+		consumerSecret: consumerSecret,
+		Log:            silentLogger{},
+	}
+}
+
+// CRCResponseToken computes the response_token answering the crc_token challenge,
+// as described in https://developer.twitter.com/en/docs/accounts-and-users/subscribe-account-activity/guides/securing-webhooks
+func CRCResponseToken(consumerSecret, crcToken string) string {
+	return "sha256=" + webhookSignature(consumerSecret, []byte(crcToken))
+}
+
+// ValidWebhookSignature reports whether signature, the value of the x-twitter-webhooks-signature header,
+// matches body signed with consumerSecret.
+func ValidWebhookSignature(consumerSecret string, body []byte, signature string) bool {
+	expected := "sha256=" + webhookSignature(consumerSecret, body)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+func webhookSignature(consumerSecret string, p []byte) string {
+	mac := hmac.New(sha256.New, []byte(consumerSecret))
+	mac.Write(p)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.serveCRC(w, r)
+	case http.MethodPost:
+		h.serveEvents(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *WebhookHandler) serveCRC(w http.ResponseWriter, r *http.Request) {
+	crcToken := r.URL.Query().Get("crc_token")
+	if crcToken == "" {
+		h.log().Warning("Twitter webhook: CRC request without crc_token")
+		http.Error(w, "missing crc_token", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		ResponseToken string `json:"response_token"`
+	}{CRCResponseToken(h.consumerSecret, crcToken)})
+}
+
+func (h *WebhookHandler) serveEvents(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxWebhookBodySize+1))
+	if err != nil {
+		h.log().Warningf("Twitter webhook: cannot read payload: %s", err)
+		http.Error(w, "cannot read payload", http.StatusBadRequest)
+		return
+	}
+	if len(body) > MaxWebhookBodySize {
+		h.log().Warning("Twitter webhook: payload too large")
+		http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if !ValidWebhookSignature(h.consumerSecret, body, r.Header.Get("X-Twitter-Webhooks-Signature")) {
+		h.log().Warning("Twitter webhook: invalid x-twitter-webhooks-signature")
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var activity AccountActivity
+	if err := json.Unmarshal(body, &activity); err != nil {
+		h.log().Warningf("Twitter webhook: cannot decode payload: %s", err)
+		http.Error(w, "cannot decode payload", http.StatusBadRequest)
+		return
+	}
+	h.dispatch(&activity)
+	w.WriteHeader(http.StatusOK)
+}
+
+// dispatch calls the callbacks registered for the events in a
+func (h *WebhookHandler) dispatch(a *AccountActivity) {
+	if h.OnActivity != nil {
+		h.OnActivity(a)
+	}
+	if h.OnTweetCreate != nil {
+		for _, e := range a.TweetCreateEvents {
+			h.OnTweetCreate(a, e)
+		}
+	}
+	if h.OnTweetDelete != nil {
+		for _, e := range a.TweetDeleteEvents {
+			h.OnTweetDelete(a, e)
+		}
+	}
+	if h.OnFavorite != nil {
+		for _, e := range a.FavoriteEvents {
+			h.OnFavorite(a, e)
+		}
+	}
+	if h.OnFollow != nil {
+		for _, e := range a.FollowEvents {
+			h.OnFollow(a, e)
+		}
+	}
+	if h.OnBlock != nil {
+		for _, e := range a.BlockEvents {
+			h.OnBlock(a, e)
+		}
+	}
+	if h.OnMute != nil {
+		for _, e := range a.MuteEvents {
+			h.OnMute(a, e)
+		}
+	}
+	if h.OnUserRevoke != nil && a.UserEvent != nil {
+		h.OnUserRevoke(a, *a.UserEvent)
+	}
+	if h.OnDirectMessage != nil {
+		for _, e := range a.DirectMessageEvents {
+			h.OnDirectMessage(a, e)
+		}
+	}
+	if h.OnDirectMessageIndicateTyping != nil {
+		for _, e := range a.DirectMessageIndicateTypingEvents {
+			h.OnDirectMessageIndicateTyping(a, e)
+		}
+	}
+	if h.OnDirectMessageMarkRead != nil {
+		for _, e := range a.DirectMessageMarkReadEvents {
+			h.OnDirectMessageMarkRead(a, e)
+		}
+	}
+}
+
+func (h *WebhookHandler) log() Logger {
+	if h.Log == nil {
+		return silentLogger{}
+	}
+	return h.Log
+}
@@ -0,0 +1,120 @@
+package anaconda_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ChimeraCoder/anaconda"
+)
+
+const webhookConsumerSecret = "consumer-secret"
+
+const webhookPayload = `{
+	"for_user_id": "2244994945",
+	"tweet_create_events": [{"id": 1, "id_str": "1", "text": "hello"}],
+	"favorite_events": [{"id": "a7ba59", "timestamp_ms": 1517879006112, "favorited_status": {"id_str": "2"}, "user": {"screen_name": "fav"}}],
+	"follow_events": [{"type": "unfollow", "source": {"screen_name": "src"}, "target": {"screen_name": "dst"}}],
+	"direct_message_events": [{"type": "message_create", "id": "954491830116155396", "created_timestamp": "1516403560557",
+		"message_create": {"target": {"recipient_id": "4337869213"}, "sender_id": "3001969357", "message_data": {"text": "Hello World!"}}}],
+	"direct_message_indicate_typing_events": [{"sender_id": "3001969357", "target": {"recipient_id": "4337869213"}}],
+	"users": {"3001969357": {"id": "3001969357", "screen_name": "jordanbrinks"}}
+}`
+
+func Test_WebhookHandler_CRC(t *testing.T) {
+	h := anaconda.NewWebhookHandler(webhookConsumerSecret)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/webhook?crc_token=challenge", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for a CRC request, received %d", rec.Code)
+	}
+
+	var body struct {
+		ResponseToken string `json:"response_token"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	// Computed independently from the consumer secret and crc_token above
+	const expected = "sha256=2RUZDVKjSpEV/C/r9ivMsVZJ4DFPAawjJFQQzY+6ba4="
+	if body.ResponseToken != expected {
+		t.Fatalf("Expected response_token %s, received %s", expected, body.ResponseToken)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/webhook", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 without crc_token, received %d", rec.Code)
+	}
+}
+
+func Test_WebhookHandler_Events(t *testing.T) {
+	h := anaconda.NewWebhookHandler(webhookConsumerSecret)
+
+	var tweets, favorites, follows, dms, typing int
+	h.OnTweetCreate = func(a *anaconda.AccountActivity, tweet anaconda.Tweet) {
+		if a.ForUserID != "2244994945" || tweet.Text != "hello" {
+			t.Errorf("Unexpected tweet_create_event %+v for %s", tweet, a.ForUserID)
+		}
+		tweets++
+	}
+	h.OnFavorite = func(a *anaconda.AccountActivity, e anaconda.FavoriteEvent) {
+		if e.User.ScreenName != "fav" || e.FavoritedStatus.IdStr != "2" {
+			t.Errorf("Unexpected favorite_event %+v", e)
+		}
+		favorites++
+	}
+	h.OnFollow = func(a *anaconda.AccountActivity, e anaconda.UserActionEvent) {
+		if e.Type != "unfollow" || e.Source.ScreenName != "src" {
+			t.Errorf("Unexpected follow_event %+v", e)
+		}
+		follows++
+	}
+	h.OnDirectMessage = func(a *anaconda.AccountActivity, e anaconda.DMEvent) {
+		if e.MessageCreate.MessageData.Text != "Hello World!" || a.Users[e.MessageCreate.SenderID].ScreenName != "jordanbrinks" {
+			t.Errorf("Unexpected direct_message_event %+v", e)
+		}
+		dms++
+	}
+	h.OnDirectMessageIndicateTyping = func(a *anaconda.AccountActivity, e anaconda.DMIndicateTypingEvent) {
+		typing++
+	}
+
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	post := func(signature string) *http.Response {
+		req, _ := http.NewRequest("POST", server.URL, strings.NewReader(webhookPayload))
+		req.Header.Set("X-Twitter-Webhooks-Signature", signature)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	if resp := post("sha256=forged"); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 for a forged signature, received %d", resp.StatusCode)
+	}
+	if tweets+favorites+follows+dms+typing != 0 {
+		t.Fatalf("Events of a forged payload were dispatched")
+	}
+
+	mac := hmac.New(sha256.New, []byte(webhookConsumerSecret))
+	mac.Write([]byte(webhookPayload))
+	signature := "sha256=" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	if resp := post(signature); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200 for a signed payload, received %d", resp.StatusCode)
+	}
+	if tweets != 1 || favorites != 1 || follows != 1 || dms != 1 || typing != 1 {
+		t.Fatalf("Expected every event to be dispatched once, received tweets=%d favorites=%d follows=%d dms=%d typing=%d",
+			tweets, favorites, follows, dms, typing)
+	}
+}
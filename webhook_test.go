@@ -0,0 +1,232 @@
+package anaconda_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/ChimeraCoder/anaconda"
+)
+
+func Test_WebhookTypedResponses(t *testing.T) {
+	apiLocal := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/account_activity/all/webhooks.json":
+			w.Write([]byte(`{"environments": [{"environment_name": "prod", "webhooks": [{"id": "1234", "url": "https://example.com/webhook", "valid": true, "created_timestamp": "2017-06-02 23:23:53 +0000"}]}]}`))
+		case "/account_activity/subscriptions/count.json":
+			w.Write([]byte(`{"account_name": "my-account", "subscriptions_count_all": "2", "subscriptions_count_direct_messages": "1"}`))
+		case "/account_activity/all/prod/subscriptions/list.json":
+			w.Write([]byte(`{"environment": "prod", "application_id": "13090192", "subscriptions": [{"user_id": "3001969357"}, {"user_id": "4337869213"}]}`))
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+			http.NotFound(w, r)
+		}
+	})
+
+	webhooks, err := apiLocal.GetAppActivityWebhooks(nil, "", "", "premium")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(webhooks) != 1 || webhooks[0].ID != "1234" || !webhooks[0].Valid || webhooks[0].EnvironmentName != "prod" {
+		t.Fatalf("Unexpected webhooks %+v", webhooks)
+	}
+
+	count, err := apiLocal.CountAppActivityWebhooks(nil, "enterprise")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count.AccountName != "my-account" || count.SubCountAll != 2 || count.SubsCountDM != 1 {
+		t.Fatalf("Unexpected count %+v", count)
+	}
+
+	list, err := apiLocal.GetWHSubscriptionList(nil, "prod", "", "premium")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := list.UserIDs(); !reflect.DeepEqual(ids, []string{"3001969357", "4337869213"}) {
+		t.Fatalf("Unexpected subscribed users %v", ids)
+	}
+}
+
+func Test_GetWHSubscription(t *testing.T) {
+	subscribed := true
+	apiLocal := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		if subscribed {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errors": [{"code": 34, "message": "Sorry, that page does not exist."}]}`))
+	})
+
+	if err := apiLocal.GetWHSubscription(nil, "prod", "", "premium"); err != nil {
+		t.Fatalf("Expected no error for an existing subscription, received %v", err)
+	}
+
+	subscribed = false
+	if err := apiLocal.GetWHSubscription(nil, "prod", "", "premium"); err != anaconda.ErrWHSubscriptionNotFound {
+		t.Fatalf("Expected %v for a missing subscription, received %v", anaconda.ErrWHSubscriptionNotFound, err)
+	}
+}
+
+// Test that every webhook function sends the request documented for each API tier
+func Test_WebhookTierURLs(t *testing.T) {
+	var method, path string
+	apiLocal := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		switch {
+		case r.Method != "GET":
+			w.WriteHeader(http.StatusNoContent)
+		case r.URL.Path == "/account_activity/all/webhooks.json":
+			w.Write([]byte(`{"environments": []}`))
+		case r.URL.Path == "/account_activity/all/prod/webhooks.json", r.URL.Path == "/account_activity/webhooks.json":
+			w.Write([]byte(`[]`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	})
+	v := url.Values{}
+
+	tests := []struct {
+		name   string
+		call   func(tier string) error
+		tier   string
+		method string
+		path   string
+	}{
+		{"GetAppActivityWebhooks all environments", func(tier string) error {
+			_, err := apiLocal.GetAppActivityWebhooks(v, "", "", tier)
+			return err
+		}, "premium", "GET", "/account_activity/all/webhooks.json"},
+		{"GetAppActivityWebhooks", func(tier string) error {
+			_, err := apiLocal.GetAppActivityWebhooks(v, "prod", "42", tier)
+			return err
+		}, "premium", "GET", "/account_activity/all/prod/webhooks.json"},
+		{"GetAppActivityWebhooks", func(tier string) error {
+			_, err := apiLocal.GetAppActivityWebhooks(v, "prod", "42", tier)
+			return err
+		}, "enterprise", "GET", "/account_activity/webhooks.json"},
+		{"SetAppActivityWebhooks", func(tier string) error {
+			_, err := apiLocal.SetAppActivityWebhooks(v, "prod", tier)
+			return err
+		}, "premium", "POST", "/account_activity/all/prod/webhooks.json"},
+		{"SetAppActivityWebhooks", func(tier string) error {
+			_, err := apiLocal.SetAppActivityWebhooks(v, "prod", tier)
+			return err
+		}, "enterprise", "POST", "/account_activity/webhooks.json"},
+		{"PutAppActivityWebhooks", func(tier string) error {
+			return apiLocal.PutAppActivityWebhooks(v, "prod", "42", tier)
+		}, "premium", "PUT", "/account_activity/all/prod/webhooks/42.json"},
+		{"PutAppActivityWebhooks", func(tier string) error {
+			return apiLocal.PutAppActivityWebhooks(v, "prod", "42", tier)
+		}, "enterprise", "PUT", "/account_activity/webhooks/42.json"},
+		{"DeleteAppActivityWebhooks", func(tier string) error {
+			return apiLocal.DeleteAppActivityWebhooks(v, "prod", "42", tier)
+		}, "premium", "DELETE", "/account_activity/all/prod/webhooks/42.json"},
+		{"DeleteAppActivityWebhooks", func(tier string) error {
+			return apiLocal.DeleteAppActivityWebhooks(v, "prod", "42", tier)
+		}, "enterprise", "DELETE", "/account_activity/webhooks/42.json"},
+		{"SetWHSubscription", func(tier string) error {
+			return apiLocal.SetWHSubscription(v, "prod", "42", tier)
+		}, "premium", "POST", "/account_activity/all/prod/subscriptions.json"},
+		{"SetWHSubscription", func(tier string) error {
+			return apiLocal.SetWHSubscription(v, "prod", "42", tier)
+		}, "enterprise", "POST", "/account_activity/webhooks/42/subscriptions/all.json"},
+		{"GetWHSubscription", func(tier string) error {
+			return apiLocal.GetWHSubscription(v, "prod", "42", tier)
+		}, "premium", "GET", "/account_activity/all/prod/subscriptions.json"},
+		{"GetWHSubscription", func(tier string) error {
+			return apiLocal.GetWHSubscription(v, "prod", "42", tier)
+		}, "enterprise", "GET", "/account_activity/webhooks/42/subscriptions/all.json"},
+		{"GetWHSubscriptionList", func(tier string) error {
+			_, err := apiLocal.GetWHSubscriptionList(v, "prod", "42", tier)
+			return err
+		}, "premium", "GET", "/account_activity/all/prod/subscriptions/list.json"},
+		{"GetWHSubscriptionList", func(tier string) error {
+			_, err := apiLocal.GetWHSubscriptionList(v, "prod", "42", tier)
+			return err
+		}, "enterprise", "GET", "/account_activity/webhooks/42/subscriptions/all/list.json"},
+		{"DeleteWHSubscription", func(tier string) error {
+			return apiLocal.DeleteWHSubscription(v, "prod", "42", tier)
+		}, "premium", "DELETE", "/account_activity/all/prod/subscriptions.json"},
+		{"DeleteWHSubscription", func(tier string) error {
+			return apiLocal.DeleteWHSubscription(v, "prod", "42", tier)
+		}, "enterprise", "DELETE", "/account_activity/webhooks/42/subscriptions/all.json"},
+		{"CountAppActivityWebhooks", func(tier string) error {
+			_, err := apiLocal.CountAppActivityWebhooks(v, tier)
+			return err
+		}, "premium", "GET", "/account_activity/all/subscriptions/count.json"},
+		{"CountAppActivityWebhooks", func(tier string) error {
+			_, err := apiLocal.CountAppActivityWebhooks(v, tier)
+			return err
+		}, "enterprise", "GET", "/account_activity/subscriptions/count.json"},
+	}
+
+	for _, test := range tests {
+		method, path = "", ""
+		if err := test.call(test.tier); err != nil {
+			t.Errorf("%s (%s): %s", test.name, test.tier, err)
+			continue
+		}
+		if method != test.method || path != test.path {
+			t.Errorf("%s (%s): expected %s %s, sent %s %s", test.name, test.tier, test.method, test.path, method, path)
+		}
+
+		method, path = "", ""
+		if err := test.call("premuim"); err != anaconda.ErrInvalidAPITier {
+			t.Errorf("%s: expected %v for an invalid tier, received %v", test.name, anaconda.ErrInvalidAPITier, err)
+		}
+		if method != "" {
+			t.Errorf("%s: a request was sent despite an invalid tier", test.name)
+		}
+	}
+}
+
+// Test that the DELETE endpoints send their parameters as the query string
+// and that 204 No Content is a success for every endpoint
+func Test_TwitterApi_DeleteAndNoContent(t *testing.T) {
+	var requests []string
+	apiLocal := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if len(body) > 0 {
+			t.Errorf("Unexpected body %q for %s %s", body, r.Method, r.URL.Path)
+		}
+		requests = append(requests, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	v := url.Values{"id": {"1234"}}
+
+	if err := apiLocal.DeleteAppActivityWebhooks(v, "prod", "42", "premium"); err != nil {
+		t.Error(err)
+	}
+	if err := apiLocal.DeleteWHSubscription(v, "prod", "", "premium"); err != nil {
+		t.Error(err)
+	}
+	if err := apiLocal.DeleteWelcomeMessage("1234"); err != nil {
+		t.Error(err)
+	}
+	// outside the endpoints which answer 204, it is no error either
+	if _, err := apiLocal.GetSearch("golang", nil); err != nil {
+		t.Errorf("Expected no error for a 204, got %v", err)
+	}
+
+	expected := []string{
+		"DELETE /account_activity/all/prod/webhooks/42.json?id=1234",
+		"DELETE /account_activity/all/prod/subscriptions.json?id=1234",
+		"DELETE /direct_messages/welcome_messages/destroy.json?id=1234",
+	}
+	if len(requests) != 4 || !reflect.DeepEqual(requests[:3], expected) {
+		t.Errorf("Received %q, expected %q", requests, expected)
+	}
+}
+
+func Test_SetAppActivityWebhooks_MissingEnvName(t *testing.T) {
+	apiLocal := newTestApi(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+	})
+	if _, err := apiLocal.SetAppActivityWebhooks(nil, "", anaconda.PremiumAPITier); err != anaconda.ErrMissingEnvName {
+		t.Errorf("Expected %v, received %v", anaconda.ErrMissingEnvName, err)
+	}
+}
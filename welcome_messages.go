@@ -0,0 +1,103 @@
+package anaconda
+
+import (
+	"errors"
+	"net/url"
+)
+
+//NewWelcomeMessage creates a welcome message named name from the text, quick reply, buttons and media of m,
+//its RecipientID and CustomProfileID are not used.
+//The welcome message is shown once made the default with NewWelcomeMessageRule.
+//https://developer.twitter.com/en/docs/direct-messages/welcome-messages/api-reference/new-welcome-message
+func (a TwitterApi) NewWelcomeMessage(name string, m *DMMessage) (message WelcomeMessage, err error) {
+	if err = m.validateMessageData(); err != nil {
+		return message, err
+	}
+	type welcomeMessage struct {
+		Name        string        `json:"name,omitempty"`
+		MessageData dmMessageData `json:"message_data"`
+	}
+	payload := struct {
+		WelcomeMessage welcomeMessage `json:"welcome_message"`
+	}{welcomeMessage{name, m.messageData()}}
+
+	resp := struct {
+		WelcomeMessage *WelcomeMessage `json:"welcome_message"`
+	}{&message}
+	err = a.sendJSONQuery(a.baseUrl+"/direct_messages/welcome_messages/new.json", payload, &resp)
+	return message, err
+}
+
+//GetWelcomeMessage returns the welcome message with the given id
+//https://developer.twitter.com/en/docs/direct-messages/welcome-messages/api-reference/get-welcome-message
+func (a TwitterApi) GetWelcomeMessage(id string) (message WelcomeMessage, err error) {
+	v := url.Values{}
+	v.Set("id", id)
+	resp := struct {
+		WelcomeMessage *WelcomeMessage `json:"welcome_message"`
+	}{&message}
+	err = a.sendQuery(a.baseUrl+"/direct_messages/welcome_messages/show.json", v, &resp, _GET)
+	return message, err
+}
+
+//GetWelcomeMessagesList returns a page of the welcome messages, see the count and cursor parameters
+//https://developer.twitter.com/en/docs/direct-messages/welcome-messages/api-reference/list-welcome-messages
+func (a TwitterApi) GetWelcomeMessagesList(v url.Values) (list WelcomeMessageList, err error) {
+	err = a.sendQuery(a.baseUrl+"/direct_messages/welcome_messages/list.json", v, &list, _GET)
+	return list, err
+}
+
+//DeleteWelcomeMessage deletes the welcome message with the given id
+//https://developer.twitter.com/en/docs/direct-messages/welcome-messages/api-reference/delete-welcome-message
+func (a TwitterApi) DeleteWelcomeMessage(id string) (err error) {
+	v := url.Values{}
+	v.Set("id", id)
+	return a.sendQuery(a.baseUrl+"/direct_messages/welcome_messages/destroy.json", v, nil, _DELETE)
+}
+
+//NewWelcomeMessageRule makes the welcome message with id welcomeMessageID the default one
+//https://developer.twitter.com/en/docs/direct-messages/welcome-messages/api-reference/new-welcome-message-rule
+func (a TwitterApi) NewWelcomeMessageRule(welcomeMessageID string) (rule WelcomeMessageRule, err error) {
+	if welcomeMessageID == "" {
+		return rule, errors.New("anaconda: welcome message rule without welcome message id")
+	}
+	payload := struct {
+		WelcomeMessageRule struct {
+			WelcomeMessageID string `json:"welcome_message_id"`
+		} `json:"welcome_message_rule"`
+	}{}
+	payload.WelcomeMessageRule.WelcomeMessageID = welcomeMessageID
+
+	resp := struct {
+		WelcomeMessageRule *WelcomeMessageRule `json:"welcome_message_rule"`
+	}{&rule}
+	err = a.sendJSONQuery(a.baseUrl+"/direct_messages/welcome_messages/rules/new.json", payload, &resp)
+	return rule, err
+}
+
+//GetWelcomeMessageRule returns the welcome message rule with the given id
+//https://developer.twitter.com/en/docs/direct-messages/welcome-messages/api-reference/get-welcome-message-rule
+func (a TwitterApi) GetWelcomeMessageRule(id string) (rule WelcomeMessageRule, err error) {
+	v := url.Values{}
+	v.Set("id", id)
+	resp := struct {
+		WelcomeMessageRule *WelcomeMessageRule `json:"welcome_message_rule"`
+	}{&rule}
+	err = a.sendQuery(a.baseUrl+"/direct_messages/welcome_messages/rules/show.json", v, &resp, _GET)
+	return rule, err
+}
+
+//GetWelcomeMessageRulesList returns a page of the welcome message rules, see the count and cursor parameters
+//https://developer.twitter.com/en/docs/direct-messages/welcome-messages/api-reference/list-welcome-message-rules
+func (a TwitterApi) GetWelcomeMessageRulesList(v url.Values) (list WelcomeMessageRuleList, err error) {
+	err = a.sendQuery(a.baseUrl+"/direct_messages/welcome_messages/rules/list.json", v, &list, _GET)
+	return list, err
+}
+
+//DeleteWelcomeMessageRule deletes the welcome message rule with the given id
+//https://developer.twitter.com/en/docs/direct-messages/welcome-messages/api-reference/delete-welcome-message-rule
+func (a TwitterApi) DeleteWelcomeMessageRule(id string) (err error) {
+	v := url.Values{}
+	v.Set("id", id)
+	return a.sendQuery(a.baseUrl+"/direct_messages/welcome_messages/rules/destroy.json", v, nil, _DELETE)
+}